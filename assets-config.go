@@ -2,9 +2,9 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
 	"sort"
+	"sync"
 
 	"github.com/Masterminds/semver"
 	"github.com/google/go-github/v35/github"
@@ -12,22 +12,26 @@ import (
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
-	"moul.io/u"
 )
 
 func doAssetsConfig(ctx context.Context, args []string) error {
-	if len(args) < 1 {
-		return flag.ErrHelp
+	paths, err := targetPaths(args)
+	if err != nil {
+		return err
 	}
-	paths := u.UniqueStrings(args)
 	logger.Debug("doAssetsConfig", zap.Any("opts", opts), zap.Strings("project", paths))
 
-	var errs error
+	var (
+		errs  error
+		mutex sync.Mutex
+	)
 	g, ctx := errgroup.WithContext(ctx)
 	for _, path := range paths {
 		path := path
 		g.Go(func() error {
 			err := doAssetsConfigOnce(ctx, path)
+			mutex.Lock()
+			defer mutex.Unlock()
 			if err != nil {
 				errs = multierr.Append(errs, fmt.Errorf("%q: %w", path, err))
 			}
@@ -48,18 +52,24 @@ type assetConfig struct {
 	SemverMapping  map[string]string `json:",omitempty"`
 }
 
-func doAssetsConfigOnce(_ context.Context, path string) error {
+func doAssetsConfigOnce(ctx context.Context, path string) error {
 	project, err := projectFromPath(path)
 	if err != nil {
 		return fmt.Errorf("invalid project: %w", err)
 	}
 
+	if project.Git.Forge != forgeGitHub {
+		return fmt.Errorf("assets-config only supports GitHub, got %q", project.Git.Forge) //nolint:goerr113
+	}
+
 	// fetch releases
 	var releases []*github.RepositoryRelease
 	{
-		client := github.NewClient(nil)
-		var err error
-		releases, _, err = client.Repositories.ListReleases(context.Background(), project.Git.RepoOwner, project.Git.RepoName, nil)
+		client, err := newGitHubClient()
+		if err != nil {
+			return fmt.Errorf("init GitHub client: %w", err)
+		}
+		releases, _, err = client.Repositories.ListReleases(ctx, project.Git.RepoOwner, project.Git.RepoName, nil)
 		if err != nil {
 			return fmt.Errorf("GH API: list releases: %w", err)
 		}
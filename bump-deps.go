@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/mod/modfile"
+	"moul.io/u"
+)
+
+// depChange is a dependency that moved during a bump, From or To is empty when it was added or removed.
+type depChange struct {
+	Path string
+	From string
+	To   string
+}
+
+func (c depChange) String() string {
+	from, to := c.From, c.To
+	if from == "" {
+		from = "(new)"
+	}
+	if to == "" {
+		to = "(removed)"
+	}
+	return fmt.Sprintf("%s %s -> %s", c.Path, from, to)
+}
+
+// goModules returns the directories containing a go.mod file, relative to the project's path.
+//
+// vendor, testdata and hidden directories are ignored, and the result is filtered by the include and exclude globs
+// of the -bump-deps-include and -bump-deps-exclude flags, or of the manifest; the go.mod files of the manifest's
+// exclude list are skipped too.
+func goModules(p *project) ([]string, error) {
+	include, exclude := splitList(opts.Maintenance.Include), splitList(opts.Maintenance.Exclude)
+	if p.Manifest != nil {
+		if len(include) == 0 {
+			include = p.Manifest.BumpDeps.Include
+		}
+		if len(exclude) == 0 {
+			exclude = p.Manifest.BumpDeps.Exclude
+		}
+	}
+
+	var modules []string
+	walk := func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != p.Path && (name == "vendor" || name == "testdata" || name == "node_modules" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+		dir, _ := filepath.Rel(p.Path, filepath.Dir(path))
+		if len(include) > 0 && !matchAnyGlob(include, dir) {
+			return nil
+		}
+		if matchAnyGlob(exclude, dir) || p.isExcluded(filepath.Join(dir, "go.mod")) {
+			return nil
+		}
+		modules = append(modules, dir)
+		return nil
+	}
+	if err := filepath.WalkDir(p.Path, walk); err != nil {
+		return nil, fmt.Errorf("walk project's dir: %w", err)
+	}
+	return modules, nil
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		pattern = filepath.Clean(pattern)
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// diffRequires compares the requirements of two versions of a go.mod file.
+func diffRequires(before, after []byte) ([]depChange, error) {
+	versions := func(content []byte) (map[string]string, error) {
+		file, err := modfile.ParseLax("go.mod", content, nil)
+		if err != nil {
+			return nil, fmt.Errorf("parse go.mod: %w", err)
+		}
+		ret := map[string]string{}
+		for _, req := range file.Require {
+			ret[req.Mod.Path] = req.Mod.Version
+		}
+		return ret, nil
+	}
+	oldVersions, err := versions(before)
+	if err != nil {
+		return nil, err
+	}
+	newVersions, err := versions(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []depChange
+	for path, version := range newVersions {
+		if oldVersions[path] != version {
+			changes = append(changes, depChange{Path: path, From: oldVersions[path], To: version})
+		}
+	}
+	for path, version := range oldVersions {
+		if _, found := newVersions[path]; !found {
+			changes = append(changes, depChange{Path: path, From: version})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// bumpDepsTask upgrades and tidies every Go module of the project, then prints which dependencies moved.
+func bumpDepsTask(ctx context.Context, p *project) (TaskStatus, error) {
+	modules, err := goModules(p)
+	if err != nil {
+		return TaskFailed, err
+	}
+	if len(modules) == 0 {
+		return TaskSkipped, nil
+	}
+	goBin := opts.Maintenance.GoBin
+	if goBin == "" && p.Manifest != nil {
+		goBin = p.Manifest.BumpDeps.GoBin
+	}
+	if goBin == "" {
+		goBin = "go"
+	}
+
+	status := TaskUnchanged
+	report := map[string][]depChange{}
+	for _, module := range modules {
+		dir := filepath.Join(p.Path, module)
+		goMod := filepath.Join(module, "go.mod")
+		before, err := ioutil.ReadFile(filepath.Join(p.Path, goMod))
+		if err != nil {
+			return TaskFailed, fmt.Errorf("read file: %q: %w", goMod, err)
+		}
+		moduleStatus, err := filesChanged(p, []string{goMod, filepath.Join(module, "go.sum")}, func() error {
+			if err := runCommandInDir(ctx, dir, goBin, "get", "-u", "./..."); err != nil {
+				return err
+			}
+			return runCommandInDir(ctx, dir, goBin, "mod", "tidy")
+		})
+		if err != nil {
+			return TaskFailed, fmt.Errorf("module %q: %w", module, err)
+		}
+		if moduleStatus != TaskChanged {
+			continue
+		}
+		status = TaskChanged
+		// a go.sum created by go mod tidy is untracked, and would be left out of the commit otherwise
+		for _, name := range []string{goMod, filepath.Join(module, "go.sum")} {
+			if !u.FileExists(filepath.Join(p.Path, name)) {
+				continue
+			}
+			if _, err := p.Git.workTree.Add(p.gitPath(name)); err != nil {
+				return TaskFailed, fmt.Errorf("git add %q: %w", name, err)
+			}
+		}
+		after, err := ioutil.ReadFile(filepath.Join(p.Path, goMod))
+		if err != nil {
+			return TaskFailed, fmt.Errorf("read file: %q: %w", goMod, err)
+		}
+		changes, err := diffRequires(before, after)
+		if err != nil {
+			return TaskFailed, fmt.Errorf("module %q: %w", module, err)
+		}
+		report[module] = changes
+	}
+
+	if len(report) > 0 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s: bumped dependencies:\n", p.Path)
+		w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+		for _, module := range modules {
+			for _, change := range report[module] {
+				fmt.Fprintf(w, "  %s\t%s\n", module, change)
+			}
+		}
+		_ = w.Flush()
+		fmt.Fprint(os.Stderr, b.String())
+	}
+	return status, nil
+}
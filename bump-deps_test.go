@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDiffRequires(t *testing.T) {
+	before := `module moul.io/foo
+
+go 1.16
+
+require (
+	github.com/a/a v1.0.0
+	github.com/b/b v1.2.0 // indirect
+	github.com/c/c v0.1.0
+)
+`
+	after := `module moul.io/foo
+
+go 1.16
+
+require (
+	github.com/a/a v1.1.0
+	github.com/b/b v1.2.0 // indirect
+	github.com/d/d v0.0.0-20210101000000-abcdefabcdef
+)
+`
+	changes, err := diffRequires([]byte(before), []byte(after))
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	expected := []depChange{
+		{Path: "github.com/a/a", From: "v1.0.0", To: "v1.1.0"},
+		{Path: "github.com/c/c", From: "v0.1.0"},
+		{Path: "github.com/d/d", To: "v0.0.0-20210101000000-abcdefabcdef"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %v, got %v", expected, changes)
+	}
+	if got := changes[1].String(); got != "github.com/c/c v0.1.0 -> (removed)" {
+		t.Errorf("unexpected string: %q", got)
+	}
+}
+
+func TestBumpDepsTaskNewGoSum(t *testing.T) {
+	logger = zap.NewNop()
+	dir := newTestProject(t)
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module moul.io/foo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return string(out)
+	}
+	git("add", "go.mod")
+	git("commit", "-qm", "go.mod")
+
+	// the fake go binary adds a dependency, and go mod tidy creates go.sum
+	goBin := filepath.Join(t.TempDir(), "go")
+	script := `#!/bin/sh
+case "$1" in
+get) echo "require example.com/x v1.1.0" >> go.mod ;;
+mod) echo "example.com/x v1.1.0 h1:0000" > go.sum ;;
+esac
+`
+	if err := ioutil.WriteFile(goBin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := opts.Maintenance
+	defer func() { opts.Maintenance = saved }()
+	opts.Maintenance.GoBin = goBin
+
+	p, err := projectFromPath(dir)
+	if err != nil {
+		t.Fatalf("project: %v", err)
+	}
+	status, err := bumpDepsTask(context.Background(), p)
+	if err != nil || status != TaskChanged {
+		t.Fatalf("expected changes, got %s, %v", status, err)
+	}
+	changes, err := p.captureChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []fileChange{{Path: "go.mod"}, {Path: "go.sum", Added: true}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %v, got %v", expected, changes)
+	}
+}
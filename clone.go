@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/google/go-github/v35/github"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/sync/errgroup"
+	"moul.io/u"
+)
+
+// clone layouts, see -layout.
+const (
+	cloneLayoutName      = "name"
+	cloneLayoutOwnerName = "owner/name"
+	cloneLayoutModule    = "module"
+)
+
+// remoteRepo is a repository listed through the GitHub API.
+type remoteRepo struct {
+	Owner    string
+	Name     string
+	CloneURL string
+	Archived bool
+	Fork     bool
+}
+
+// cloneResult is what was done for a remote repo.
+type cloneResult struct {
+	Repo   *remoteRepo
+	Path   string
+	Status string // cloned, fetched, up to date, or skipped
+	Reason string
+}
+
+func doClone(ctx context.Context, args []string) error {
+	if len(args) > 0 || opts.Clone.Owner == "" {
+		return flag.ErrHelp
+	}
+	switch opts.Clone.Layout {
+	case cloneLayoutName, cloneLayoutOwnerName, cloneLayoutModule:
+	default:
+		return fmt.Errorf("invalid -layout: %q", opts.Clone.Layout) //nolint:goerr113
+	}
+	into, err := u.ExpandPath(opts.Clone.Into)
+	if err != nil {
+		return fmt.Errorf("invalid -into: %w", err)
+	}
+	logger.Debug("doClone", zap.Any("opts", opts), zap.String("into", into))
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	repos, err := listGitHubRepos(ctx, client, opts.Clone.Owner, opts.Clone.SSH)
+	if err != nil {
+		return err
+	}
+	results, errs := cloneRepos(ctx, client, repos, into)
+	fmt.Fprint(os.Stderr, cloneSummary(results))
+	return errs
+}
+
+// listGitHubRepos returns the repositories of an organization or a user, sorted by name.
+func listGitHubRepos(ctx context.Context, client *github.Client, owner string, ssh bool) ([]*remoteRepo, error) {
+	var (
+		ret    []*remoteRepo
+		isUser bool
+		page   = 1
+	)
+	for page != 0 {
+		var (
+			repos []*github.Repository
+			resp  *github.Response
+			err   error
+		)
+		listOptions := github.ListOptions{Page: page, PerPage: 100}
+		if !isUser {
+			repos, resp, err = client.Repositories.ListByOrg(ctx, owner, &github.RepositoryListByOrgOptions{ListOptions: listOptions})
+			if resp != nil && resp.StatusCode == http.StatusNotFound { // not an organization
+				isUser = true
+				continue
+			}
+		} else {
+			repos, resp, err = client.Repositories.List(ctx, owner, &github.RepositoryListOptions{ListOptions: listOptions})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("list %s's repos: %w", owner, err)
+		}
+		for _, repo := range repos {
+			cloneURL := repo.GetCloneURL()
+			if ssh {
+				cloneURL = repo.GetSSHURL()
+			}
+			ret = append(ret, &remoteRepo{
+				Owner:    repo.GetOwner().GetLogin(),
+				Name:     repo.GetName(),
+				CloneURL: cloneURL,
+				Archived: repo.GetArchived(),
+				Fork:     repo.GetFork(),
+			})
+		}
+		page = resp.NextPage
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret, nil
+}
+
+// cloneRepos clones the missing repos in into, and fetches the existing clones, -jobs at a time.
+func cloneRepos(ctx context.Context, client *github.Client, repos []*remoteRepo, into string) ([]*cloneResult, error) {
+	var (
+		errs    error
+		results []*cloneResult
+		mutex   sync.Mutex
+	)
+	g, ctx := errgroup.WithContext(ctx)
+	if opts.Clone.Jobs > 0 {
+		g.SetLimit(opts.Clone.Jobs)
+	}
+	for _, repo := range repos {
+		repo := repo
+		g.Go(func() error {
+			result, err := cloneRepo(ctx, client, repo, into)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("%s/%s: %w", repo.Owner, repo.Name, err))
+				return nil
+			}
+			results = append(results, result)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Repo.Name < results[j].Repo.Name })
+	return results, errs
+}
+
+func cloneRepo(ctx context.Context, client *github.Client, repo *remoteRepo, into string) (*cloneResult, error) {
+	result := &cloneResult{Repo: repo, Status: "skipped"}
+	switch {
+	case repo.Archived && opts.Clone.SkipArchived:
+		result.Reason = "archived"
+		return result, nil
+	case repo.Fork && opts.Clone.SkipForks:
+		result.Reason = "fork"
+		return result, nil
+	}
+
+	path, err := cloneLayoutPath(ctx, client, repo, into, opts.Clone.Layout)
+	if err != nil {
+		return nil, err
+	}
+	result.Path = path
+	auth := gitAuthForURL(repo.CloneURL)
+
+	// existing clone
+	if u.DirExists(path) {
+		local, err := git.PlainOpen(path)
+		if err != nil {
+			return nil, fmt.Errorf("open existing clone: %q: %w", path, err)
+		}
+		err = local.FetchContext(ctx, &git.FetchOptions{RemoteName: "origin", Auth: auth})
+		switch {
+		case errors.Is(err, git.NoErrAlreadyUpToDate):
+			result.Status = "up to date"
+		case err != nil:
+			return nil, fmt.Errorf("fetch %q: %w", path, err)
+		default:
+			result.Status = "fetched"
+		}
+		return result, nil
+	}
+
+	// missing clone
+	logger.Debug("clone", zap.String("url", repo.CloneURL), zap.String("path", path))
+	_, err = git.PlainCloneContext(ctx, path, false, &git.CloneOptions{URL: repo.CloneURL, Auth: auth})
+	switch {
+	case errors.Is(err, transport.ErrEmptyRemoteRepository):
+		_ = os.RemoveAll(path)
+		result.Reason = "empty"
+	case err != nil:
+		_ = os.RemoveAll(path)
+		return nil, fmt.Errorf("clone %q: %w", repo.CloneURL, err)
+	default:
+		result.Status = "cloned"
+	}
+	return result, nil
+}
+
+// cloneLayoutPath returns where a repo is cloned in into:
+//
+//	name        <into>/<name>
+//	owner/name  <into>/<owner>/<name>
+//	module      <into>/<module path>, i.e., GOPATH-like, or <into>/github.com/<owner>/<name> without go.mod
+func cloneLayoutPath(ctx context.Context, client *github.Client, repo *remoteRepo, into, layout string) (string, error) {
+	switch layout {
+	case cloneLayoutOwnerName:
+		return filepath.Join(into, repo.Owner, repo.Name), nil
+	case cloneLayoutModule:
+		modulePath := "github.com/" + repo.Owner + "/" + repo.Name
+		file, _, resp, err := client.Repositories.GetContents(ctx, repo.Owner, repo.Name, "go.mod", nil)
+		switch {
+		case resp != nil && resp.StatusCode == http.StatusNotFound:
+			// not a Go module
+		case err != nil:
+			return "", fmt.Errorf("get go.mod: %w", err)
+		default:
+			content, err := file.GetContent()
+			if err != nil {
+				return "", fmt.Errorf("decode go.mod: %w", err)
+			}
+			if path := modfile.ModulePath([]byte(content)); path != "" {
+				modulePath = path
+			}
+		}
+		return filepath.Join(into, filepath.FromSlash(modulePath)), nil
+	default:
+		return filepath.Join(into, repo.Name), nil
+	}
+}
+
+// cloneSummary returns a report of what was done for each repo.
+func cloneSummary(results []*cloneResult) string {
+	var b bytes.Buffer
+	counts := map[string]int{}
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	for _, result := range results {
+		counts[result.Status]++
+		status := result.Status
+		if result.Reason != "" {
+			status += ": " + result.Reason
+		}
+		fmt.Fprintf(w, "  %s/%s\t%s\t%s\n", result.Repo.Owner, result.Repo.Name, status, result.Path)
+	}
+	_ = w.Flush()
+	return fmt.Sprintf("%d repo(s): %d cloned, %d fetched, %d up to date, %d skipped\n%s",
+		len(results), counts["cloned"], counts["fetched"], counts["up to date"], counts["skipped"], b.String())
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/google/go-github/v35/github"
+	"go.uber.org/zap"
+	"moul.io/u"
+)
+
+// fakeGitHubRepos is a minimal stand-in of the GitHub repositories API, for a user with two pages of repos.
+type fakeGitHubRepos struct {
+	pages   [][]*github.Repository
+	goMods  map[string]string // repo name -> go.mod content
+	baseURL string
+}
+
+func (f *fakeGitHubRepos) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/orgs/moul/repos":
+		http.NotFound(w, r)
+	case "/users/moul/repos":
+		page := 1
+		if r.URL.Query().Get("page") == "2" {
+			page = 2
+		}
+		if page < len(f.pages) {
+			w.Header().Set("Link", fmt.Sprintf(`<%susers/moul/repos?page=%d>; rel="next"`, f.baseURL, page+1))
+		}
+		_ = json.NewEncoder(w).Encode(f.pages[page-1])
+	default:
+		for name, content := range f.goMods {
+			if r.URL.Path == "/repos/moul/"+name+"/contents/go.mod" {
+				_ = json.NewEncoder(w).Encode(&github.RepositoryContent{
+					Type:     github.String("file"),
+					Encoding: github.String("base64"),
+					Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+				})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}
+}
+
+// newBareRepo returns the path of a bare repository with one commit.
+func newBareRepo(t *testing.T) string {
+	t.Helper()
+	work := t.TempDir()
+	repo, err := git.PlainInit(work, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(work, "README.md"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	workTree, _ := repo.Worktree()
+	if _, err := workTree.Add("README.md"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := workTree.Commit("initial", &git.CommitOptions{Author: gitSignature(repo)}); err != nil {
+		t.Fatal(err)
+	}
+	bare := t.TempDir()
+	if _, err := git.PlainClone(bare, true, &git.CloneOptions{URL: work}); err != nil {
+		t.Fatal(err)
+	}
+	return bare
+}
+
+func TestCloneRepos(t *testing.T) {
+	logger = zap.NewNop()
+	fake := &fakeGitHubRepos{goMods: map[string]string{"foo": "module moul.io/foo\n\ngo 1.16\n"}}
+	remote := func(name string, archived, fork bool) *github.Repository {
+		return &github.Repository{
+			Name:     github.String(name),
+			Owner:    &github.User{Login: github.String("moul")},
+			CloneURL: github.String(newBareRepo(t)),
+			Archived: github.Bool(archived),
+			Fork:     github.Bool(fork),
+		}
+	}
+	fake.pages = [][]*github.Repository{
+		{remote("foo", false, false), remote("bar", true, false)},
+		{remote("baz", false, true)},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	fake.baseURL = server.URL + "/"
+	client := github.NewClient(server.Client())
+	client.BaseURL, _ = url.Parse(fake.baseURL)
+	ctx := context.Background()
+
+	repos, err := listGitHubRepos(ctx, client, "moul", false)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(repos) != 3 || repos[0].Name != "bar" || !repos[0].Archived || !repos[1].Fork {
+		t.Fatalf("unexpected repos: %+v", repos)
+	}
+
+	saved := opts.Clone
+	defer func() { opts.Clone = saved }()
+	opts.Clone.Layout = cloneLayoutModule
+	opts.Clone.SkipArchived = true
+	opts.Clone.Jobs = 1
+	into := t.TempDir()
+	statuses := func() map[string]string {
+		results, err := cloneRepos(ctx, client, repos, into)
+		if err != nil {
+			t.Fatalf("clone: %v", err)
+		}
+		ret := map[string]string{}
+		for _, result := range results {
+			ret[result.Repo.Name] = result.Status + " " + result.Reason
+		}
+		return ret
+	}
+
+	expected := map[string]string{"bar": "skipped archived", "baz": "cloned ", "foo": "cloned "}
+	if got := statuses(); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	for _, path := range []string{"moul.io/foo/README.md", "github.com/moul/baz/README.md"} {
+		if !u.FileExists(filepath.Join(into, path)) {
+			t.Errorf("expected %s to be cloned", path)
+		}
+	}
+
+	// existing clones are fetched
+	expected = map[string]string{"bar": "skipped archived", "baz": "up to date ", "foo": "up to date "}
+	if got := statuses(); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"moul.io/u"
+)
+
+// copyrightRegex matches a copyright statement followed by a list of years, i.e.,
+// "© 2019", "Copyright 2014-2020", "Copyright (c) 2015, 2017-2019".
+//
+// The third group is set when the list is followed by a dash, i.e., "2015-present" or "2019-20".
+var copyrightRegex = regexp.MustCompile(`(?i)((?:copyright(?:[ \t]+\(c\)|[ \t]+©)?|©)[ \t]+)([0-9]{4}(?:[ \t]*-[ \t]*[0-9]{4})?(?:[ \t]*,[ \t]*[0-9]{4}(?:[ \t]*-[ \t]*[0-9]{4})?)*)\b([ \t]*-)?`)
+
+var copyrightYearRegex = regexp.MustCompile(`[0-9]{4}`)
+
+// copyrightYear returns the year copyright statements should end with, overridable with -year.
+func copyrightYear() int {
+	if opts.Year != 0 {
+		return opts.Year
+	}
+	return time.Now().Year()
+}
+
+// updateCopyright makes every copyright statement of content end with year.
+//
+// A single year becomes a range, the end of a range is replaced, and the last item of a list is updated.
+// Statements already mentioning year, or a later one, are kept as is, and so are the ones
+// with an open or unusual range, i.e., "2015-present" or "2019-20".
+func updateCopyright(content []byte, year int) []byte {
+	return copyrightRegex.ReplaceAllFunc(content, func(match []byte) []byte {
+		parts := copyrightRegex.FindSubmatch(match)
+		prefix, years := string(parts[1]), string(parts[2])
+		if len(parts[3]) > 0 {
+			return match
+		}
+
+		latest := 0
+		for _, raw := range copyrightYearRegex.FindAllString(years, -1) {
+			if y, _ := strconv.Atoi(raw); y > latest {
+				latest = y
+			}
+		}
+		if latest >= year {
+			return match
+		}
+
+		items := strings.Split(years, ",")
+		last := items[len(items)-1]
+		trimmed := strings.TrimSpace(last)
+		leading := last[:strings.Index(last, trimmed)]
+		if idx := strings.LastIndex(trimmed, "-"); idx != -1 {
+			trimmed = strings.TrimSpace(trimmed[:idx])
+		}
+		items[len(items)-1] = fmt.Sprintf("%s%s-%d", leading, trimmed, year)
+		return []byte(prefix + strings.Join(items, ","))
+	})
+}
+
+// updateGoFileHeader updates the copyright statements of the comments preceding the package clause.
+func updateGoFileHeader(content []byte, year int) []byte {
+	end := bytes.Index(content, []byte("\npackage "))
+	if end == -1 {
+		return content
+	}
+	header := updateCopyright(content[:end], year)
+	return append(header, content[end:]...)
+}
+
+// copyrightFiles returns the files that can contain copyright statements, relative to the project's path.
+func copyrightFiles(p *project) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"README.md", "LICENSE*", "COPYRIGHT"} {
+		matches, err := filepath.Glob(filepath.Join(p.Path, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("glob: %w", err)
+		}
+		for _, match := range matches {
+			rel, _ := filepath.Rel(p.Path, match)
+			if u.FileExists(match) && !p.isExcluded(rel) {
+				files = append(files, rel)
+			}
+		}
+	}
+
+	walk := func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			switch d.Name() {
+			case ".git", "vendor", "node_modules", "testdata":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel, _ := filepath.Rel(p.Path, path); strings.HasSuffix(path, ".go") && !p.isExcluded(rel) {
+			files = append(files, rel)
+		}
+		return nil
+	}
+	if err := filepath.WalkDir(p.Path, walk); err != nil {
+		return nil, fmt.Errorf("walk project's dir: %w", err)
+	}
+	return files, nil
+}
+
+// updateCopyrightFiles returns the files with stale copyright statements, and updates them if write is true.
+func updateCopyrightFiles(p *project, year int, write bool) ([]string, error) {
+	files, err := copyrightFiles(p)
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, name := range files {
+		path := filepath.Join(p.Path, name)
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read file: %q: %w", name, err)
+		}
+		var newContent []byte
+		if strings.HasSuffix(name, ".go") {
+			newContent = updateGoFileHeader(content, year)
+		} else {
+			newContent = updateCopyright(content, year)
+		}
+		if bytes.Equal(content, newContent) {
+			continue
+		}
+		stale = append(stale, name)
+		if write {
+			if err := ioutil.WriteFile(path, newContent, 0); err != nil {
+				return nil, fmt.Errorf("write file: %q: %w", name, err)
+			}
+		}
+	}
+	return stale, nil
+}
+
+func copyrightTask(_ context.Context, p *project) (TaskStatus, error) {
+	updated, err := updateCopyrightFiles(p, copyrightYear(), true)
+	if err != nil {
+		return TaskFailed, err
+	}
+	if len(updated) == 0 {
+		return TaskUnchanged, nil
+	}
+	return TaskChanged, nil
+}
+
+var copyrightCheck = &fixableCheck{
+	simpleCheck: &simpleCheck{
+		id:          "copyright-year",
+		description: "copyright statements are up to date",
+		severity:    SeverityWarning,
+		run: func(p *project) ([]string, error) {
+			year := copyrightYear()
+			stale, err := updateCopyrightFiles(p, year, false)
+			if err != nil {
+				return nil, err
+			}
+			messages := make([]string, 0, len(stale))
+			for _, name := range stale {
+				messages = append(messages, fmt.Sprintf("%s: copyright does not include %d", name, year))
+			}
+			return messages, nil
+		},
+	},
+	fix: func(p *project) error {
+		_, err := updateCopyrightFiles(p, copyrightYear(), true)
+		return err
+	},
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUpdateCopyright(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"© 2021   [Manfred Touron]", "© 2021-2026   [Manfred Touron]"},
+		{"Copyright 2019 Foo", "Copyright 2019-2026 Foo"},
+		{"Copyright (c) 2014-2020 Foo", "Copyright (c) 2014-2026 Foo"},
+		{"Copyright © 2015 - 2018 Foo", "Copyright © 2015-2026 Foo"},
+		{"copyright 2014, 2016 Foo", "copyright 2014, 2016-2026 Foo"},
+		{"Copyright (c) 2014, 2016-2019, Foo", "Copyright (c) 2014, 2016-2026, Foo"},
+		{"Copyright 2026 Foo", "Copyright 2026 Foo"},
+		{"Copyright 2020-2026 Foo", "Copyright 2020-2026 Foo"},
+		{"Copyright 2027 Foo", "Copyright 2027 Foo"},
+		{"no statement 2019", "no statement 2019"},
+		{"Copyright 2015-present Foo", "Copyright 2015-present Foo"},
+		{"Copyright (c) 2014, 2016-Present Foo", "Copyright (c) 2014, 2016-Present Foo"},
+		{"© 2015 - present Foo", "© 2015 - present Foo"},
+		{"Copyright 2019-20 Foo", "Copyright 2019-20 Foo"},
+		{"Copyright 2014-2019-20 Foo", "Copyright 2014-2019-20 Foo"},
+		{"Copyright 2019 Foo\n© 2020 Bar\n", "Copyright 2019-2026 Foo\n© 2020-2026 Bar\n"},
+	}
+	for _, tc := range cases {
+		ret := string(updateCopyright([]byte(tc.input), 2026))
+		if ret != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, ret)
+		}
+	}
+}
+
+func TestUpdateGoFileHeader(t *testing.T) {
+	input := "// Copyright 2020 Foo\n\npackage foo\n\n// Copyright 2020 is not a header\n"
+	expected := "// Copyright 2020-2026 Foo\n\npackage foo\n\n// Copyright 2020 is not a header\n"
+	if ret := string(updateGoFileHeader([]byte(input), 2026)); ret != expected {
+		t.Errorf("expected %q, got %q", expected, ret)
+	}
+}
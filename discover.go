@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"moul.io/u"
+)
+
+func doDiscover(_ context.Context, args []string) error {
+	if len(args) < 1 {
+		return flag.ErrHelp
+	}
+	logger.Debug("doDiscover", zap.Any("opts", opts), zap.Strings("dirs", args))
+	paths, err := discoverRepos(u.UniqueStrings(args), opts.Workspace.MaxDepth, splitList(opts.Workspace.Ignore))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// discoverRepos walks down dirs and returns the root of the git repositories found, sorted.
+//
+// Repositories nested in another one are not returned, the walk stops at the first .git directory.
+// maxDepth limits the depth of the walk below each dir (0 for no limit), and the directories matching
+// one of the ignore globs, by name or by path relative to the walked dir, are skipped.
+func discoverRepos(dirs []string, maxDepth int, ignore []string) ([]string, error) {
+	var ret []string
+	for _, dir := range dirs {
+		expanded, err := u.ExpandPath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path: %q: %w", dir, err)
+		}
+		if !u.DirExists(expanded) {
+			return nil, fmt.Errorf("path is not a directory: %q", dir) //nolint:goerr113
+		}
+		err = filepath.WalkDir(expanded, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				logger.Warn("cannot walk directory", zap.String("path", path), zap.Error(err))
+				return nil
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			rel, _ := filepath.Rel(expanded, path)
+			if rel != "." {
+				if d.Name() == ".git" || matchAnyGlob(ignore, d.Name()) || matchAnyGlob(ignore, filepath.ToSlash(rel)) {
+					return filepath.SkipDir
+				}
+			}
+			if u.DirExists(filepath.Join(path, ".git")) {
+				ret = append(ret, path)
+				return filepath.SkipDir
+			}
+			if maxDepth > 0 && rel != "." && strings.Count(filepath.ToSlash(rel), "/")+1 >= maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walk %q: %w", dir, err)
+		}
+	}
+	ret = u.UniqueStrings(ret)
+	sort.Strings(ret)
+	return ret, nil
+}
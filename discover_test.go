@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDiscoverRepos(t *testing.T) {
+	logger = zap.NewNop()
+	root := t.TempDir()
+	for _, dir := range []string{
+		"a/.git",
+		"a/nested/.git", // inside a, not returned
+		"b/c/.git",
+		"b/d/e/.git", // too deep with -max-depth 2
+		"node_modules/f/.git",
+		".cache/g/.git",
+		"h", // not a repo
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		maxDepth int
+		ignore   []string
+		expected []string
+	}{
+		{0, []string{"node_modules", ".*"}, []string{"a", "b/c", "b/d/e"}},
+		{2, []string{"node_modules", ".*"}, []string{"a", "b/c"}},
+		{0, []string{"b/d"}, []string{".cache/g", "a", "b/c", "node_modules/f"}},
+		{1, nil, []string{"a"}},
+	}
+	for _, tt := range tests {
+		got, err := discoverRepos([]string{root}, tt.maxDepth, tt.ignore)
+		if err != nil {
+			t.Fatalf("discover: %v", err)
+		}
+		expected := make([]string, 0, len(tt.expected))
+		for _, dir := range tt.expected {
+			expected = append(expected, filepath.Join(root, dir))
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("max-depth=%d ignore=%v: expected %v, got %v", tt.maxDepth, tt.ignore, expected, got)
+		}
+	}
+
+	// a repo given directly is returned as is
+	if got, _ := discoverRepos([]string{filepath.Join(root, "a")}, 1, nil); !reflect.DeepEqual(got, []string{filepath.Join(root, "a")}) {
+		t.Errorf("expected the repo itself, got %v", got)
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
@@ -11,36 +14,398 @@ import (
 	"moul.io/u"
 )
 
+// Severity is the importance of a doctor finding.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+
+	// severityNone is only used as a threshold, to never fail.
+	severityNone
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	case severityNone:
+		return "none"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+func parseSeverity(s string) (Severity, error) {
+	for _, severity := range []Severity{SeverityInfo, SeverityWarning, SeverityError, severityNone} {
+		if severity.String() == strings.ToLower(s) {
+			return severity, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid severity: %q", s) //nolint:goerr113
+}
+
+// Finding is a problem detected by a Check.
+type Finding struct {
+	Check    string
+	Severity Severity
+	Message  string
+	Fixed    bool
+}
+
+// Check is a read-only verification performed by the doctor subcommand.
+type Check interface {
+	ID() string
+	Description() string
+	Severity() Severity
+	// Applies returns whether the check makes sense for the project, i.e., Go checks on a non-Go project.
+	Applies(p *project) bool
+	// Run returns the findings, an error means that the check itself failed.
+	Run(p *project) ([]Finding, error)
+}
+
+// simpleCheck implements Check with functions, it is used by the built-in checks.
+type simpleCheck struct {
+	id          string
+	description string
+	severity    Severity
+	applies     func(p *project) bool
+	run         func(p *project) ([]string, error) // returns a message per finding
+}
+
+func (c *simpleCheck) ID() string          { return c.id }
+func (c *simpleCheck) Description() string { return c.description }
+func (c *simpleCheck) Severity() Severity  { return c.severity }
+
+func (c *simpleCheck) Applies(p *project) bool {
+	if c.applies == nil {
+		return true
+	}
+	return c.applies(p)
+}
+
+func (c *simpleCheck) Run(p *project) ([]Finding, error) {
+	messages, err := c.run(p)
+	if err != nil {
+		return nil, err
+	}
+	findings := make([]Finding, 0, len(messages))
+	for _, message := range messages {
+		findings = append(findings, Finding{Check: c.id, Severity: c.severity, Message: message})
+	}
+	return findings, nil
+}
+
+// Fixer is an optional interface implemented by the checks that know how to fix their findings.
+type Fixer interface {
+	// Fix edits the worktree to resolve the findings previously reported by the check.
+	Fix(p *project) error
+}
+
+// fixableCheck is a simpleCheck with a fixer.
+type fixableCheck struct {
+	*simpleCheck
+	fix func(p *project) error
+}
+
+func (c *fixableCheck) Fix(p *project) error { return c.fix(p) }
+
+func inGitRepo(p *project) bool { return p.Git.Root != "" }
+
+// doctorChecks is the registry of the checks performed by the doctor subcommand.
+var doctorChecks = []Check{
+	&simpleCheck{
+		id:          "git-repo",
+		description: "project is within a git repository",
+		severity:    SeverityError,
+		run: func(p *project) ([]string, error) {
+			if !inGitRepo(p) {
+				return []string{"project is not within a git repository"}, nil
+			}
+			return nil, nil
+		},
+	},
+	&simpleCheck{
+		id:          "forge",
+		description: "origin is hosted on a known forge",
+		severity:    SeverityWarning,
+		applies:     inGitRepo,
+		run: func(p *project) ([]string, error) {
+			if p.Git.Forge == forgeUnknown {
+				return []string{fmt.Sprintf("cannot guess the forge of %q, set 'forge' in repoman.yml", p.Git.Host)}, nil
+			}
+			return nil, nil
+		},
+	},
+	&simpleCheck{
+		id:          "main-branch",
+		description: "worktree is on the main branch",
+		severity:    SeverityInfo,
+		applies:     inGitRepo,
+		run: func(p *project) ([]string, error) {
+			if p.Git.MainBranch == "n/a" || p.Git.MainBranch == "" {
+				return []string{"cannot detect the main branch"}, nil
+			}
+			if !p.Git.InMainBranch {
+				return []string{fmt.Sprintf("current branch is %q instead of %q", p.Git.CurrentBranch, p.Git.MainBranch)}, nil
+			}
+			return nil, nil
+		},
+	},
+	&simpleCheck{
+		id:          "dirty-worktree",
+		description: "worktree has no uncommitted changes",
+		severity:    SeverityInfo,
+		applies:     inGitRepo,
+		run: func(p *project) ([]string, error) {
+			if err := p.updateStatus(); err != nil {
+				return nil, err
+			}
+			if *p.Git.IsDirty {
+				return []string{"worktree has uncommitted changes"}, nil
+			}
+			return nil, nil
+		},
+	},
+	&simpleCheck{
+		id:          "repoman-files",
+		description: "project contains the files required by repoman",
+		severity:    SeverityWarning,
+		applies:     inGitRepo,
+		run: func(p *project) ([]string, error) {
+			var messages []string
+			for _, expected := range repomanRequiredFiles {
+				if !u.FileExists(filepath.Join(p.Path, expected)) {
+					messages = append(messages, fmt.Sprintf("missing file: %q", expected))
+				}
+			}
+			return messages, nil
+		},
+	},
+	&fixableCheck{
+		simpleCheck: &simpleCheck{
+			id:          "renovate-location",
+			description: "renovate config is stored in .github/",
+			severity:    SeverityWarning,
+			applies:     inGitRepo,
+			run: func(p *project) ([]string, error) {
+				if renovateConfigMisplaced(p) {
+					return []string{"renovate.json should be moved to .github/renovate.json"}, nil
+				}
+				return nil, nil
+			},
+		},
+		fix: moveRenovateConfig,
+	},
+	&simpleCheck{
+		id:          "license",
+		description: "project has a license",
+		severity:    SeverityWarning,
+		run: func(p *project) ([]string, error) {
+			matches, err := filepath.Glob(filepath.Join(p.Path, "LICENSE*"))
+			if err != nil {
+				return nil, fmt.Errorf("glob: %w", err)
+			}
+			if len(matches) == 0 && !u.FileExists(filepath.Join(p.Path, "COPYRIGHT")) {
+				return []string{"no LICENSE or COPYRIGHT file"}, nil
+			}
+			return nil, nil
+		},
+	},
+	copyrightCheck,
+	workflowsCheck,
+	&simpleCheck{
+		id:          "go-mod",
+		description: "Go projects use Go modules",
+		severity:    SeverityWarning,
+		applies: func(p *project) bool {
+			return p.Git.Metadata.HasGo != nil && *p.Git.Metadata.HasGo
+		},
+		run: func(p *project) ([]string, error) {
+			if !u.FileExists(filepath.Join(p.Path, "go.mod")) {
+				return []string{"missing go.mod"}, nil
+			}
+			return nil, nil
+		},
+	},
+}
+
+// doctorReport contains the findings for a project.
+type doctorReport struct {
+	Path     string
+	Findings []Finding
+	Checks   int // number of checks that applied to the project
+}
+
 func doDoctor(ctx context.Context, args []string) error {
-	if len(args) < 1 {
-		return flag.ErrHelp
+	threshold, err := parseSeverity(opts.Doctor.FailOn)
+	if err != nil {
+		return fmt.Errorf("invalid -fail-on: %w", err)
+	}
+	paths, err := targetPaths(args)
+	if err != nil {
+		return err
 	}
-	paths := u.UniqueStrings(args)
 	logger.Debug("doDoctor", zap.Any("opts", opts), zap.Strings("project", paths))
 
-	var errs error
+	var (
+		errs    error
+		reports []*doctorReport
+		mutex   sync.Mutex
+	)
 	g, ctx := errgroup.WithContext(ctx)
 	for _, path := range paths {
 		path := path
 		g.Go(func() error {
-			err := doDoctorOnce(ctx, path)
+			report, err := doDoctorOnce(ctx, path)
+			mutex.Lock()
+			defer mutex.Unlock()
 			if err != nil {
 				errs = multierr.Append(errs, fmt.Errorf("%q: %w", path, err))
+				return nil
 			}
+			reports = append(reports, report)
 			return nil
 		})
 	}
 	_ = g.Wait()
+
+	// print reports in a stable order
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Path < reports[j].Path })
+	reached := 0
+	for _, report := range reports {
+		fmt.Print(report.String())
+		reached += report.reached(threshold)
+	}
+	if reached > 0 {
+		errs = multierr.Append(errs, fmt.Errorf("%d finding(s) at or above the %q severity", reached, threshold)) //nolint:goerr113
+	}
 	return errs
 }
 
-func doDoctorOnce(_ context.Context, path string) error {
-	project, err := projectFromPath(path)
+func doDoctorOnce(ctx context.Context, path string) (*doctorReport, error) {
+	if !opts.Doctor.Fix {
+		project, err := projectFromPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid project: %w", err)
+		}
+		return doDoctorProject(ctx, project)
+	}
+
+	var report *doctorReport
+	err := runWriteCommand(ctx, "doctor-fix", path, opts.Doctor.Project, func(project *project) error {
+		if err := project.prepareWorkspace(opts.Doctor.Project); err != nil {
+			return fmt.Errorf("prepare workspace: %w", err)
+		}
+		var err error
+		report, err = doDoctorProject(ctx, project)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("invalid project: %w", err)
+		return nil, err
+	}
+	report.Path, _ = filepath.Abs(path) // the checks may have run on a -dry-run copy
+	return report, nil
+}
+
+//nolint:gocognit
+func doDoctorProject(ctx context.Context, project *project) (*doctorReport, error) {
+	report := &doctorReport{Path: project.Path}
+
+	for _, check := range doctorChecks {
+		if !project.Manifest.taskEnabled(check.ID(), true) || !check.Applies(project) {
+			logger.Debug("skip check", zap.String("check", check.ID()), zap.String("project", project.Path))
+			continue
+		}
+		report.Checks++
+		findings, err := check.Run(project)
+		if err != nil {
+			return nil, fmt.Errorf("check %q: %w", check.ID(), err)
+		}
+
+		if fixer, ok := check.(Fixer); ok && opts.Doctor.Fix && len(findings) > 0 {
+			logger.Debug("fix", zap.String("check", check.ID()), zap.String("project", project.Path))
+			if err := fixer.Fix(project); err != nil {
+				return nil, fmt.Errorf("fix %q: %w", check.ID(), err)
+			}
+			remaining, err := check.Run(project)
+			if err != nil {
+				return nil, fmt.Errorf("check %q: %w", check.ID(), err)
+			}
+			if len(remaining) == 0 {
+				for i := range findings {
+					findings[i].Fixed = true
+				}
+			} else {
+				findings = remaining
+			}
+		}
+		report.Findings = append(report.Findings, findings...)
+	}
+
+	if opts.Doctor.Fix {
+		_, err := project.pushChanges(ctx, opts.Doctor.Project, "dev/moul/doctor-fix", "chore: doctor fixes 🤖")
+		if err != nil {
+			return nil, fmt.Errorf("push changes: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// reached returns the number of unfixed findings with the threshold severity or above.
+func (r *doctorReport) reached(threshold Severity) int {
+	ret := 0
+	for _, finding := range r.Findings {
+		if finding.Severity >= threshold && !finding.Fixed {
+			ret++
+		}
+	}
+	return ret
+}
+
+// score returns the percentage of the checks without unfixed findings.
+func (r *doctorReport) score() int {
+	if r.Checks == 0 {
+		return 100
+	}
+	failing := map[string]bool{}
+	for _, finding := range r.Findings {
+		if !finding.Fixed {
+			failing[finding.Check] = true
+		}
+	}
+	return (r.Checks - len(failing)) * 100 / r.Checks
+}
+
+// String returns a human-readable report with findings grouped by severity, most important first.
+func (r *doctorReport) String() string {
+	if len(r.Findings) == 0 {
+		return fmt.Sprintf("%s: OK\n", r.Path)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:\n", r.Path)
+	for severity := SeverityError; severity >= SeverityInfo; severity-- {
+		var lines []string
+		for _, finding := range r.Findings {
+			switch {
+			case finding.Severity != severity:
+			case finding.Fixed:
+				lines = append(lines, fmt.Sprintf("    [%s] %s (fixed)\n", finding.Check, finding.Message))
+			default:
+				lines = append(lines, fmt.Sprintf("    [%s] %s\n", finding.Check, finding.Message))
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s:\n", severity)
+		for _, line := range lines {
+			b.WriteString(line)
+		}
 	}
-	_ = project
-	// FIXME: perform more tests
-	fmt.Println("OK")
-	return nil
+	return b.String()
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakeCheck is a Check returning fixed findings.
+type fakeCheck struct {
+	id       string
+	severity Severity
+	skip     bool
+	messages []string
+}
+
+func (c *fakeCheck) ID() string              { return c.id }
+func (c *fakeCheck) Description() string     { return c.id }
+func (c *fakeCheck) Severity() Severity      { return c.severity }
+func (c *fakeCheck) Applies(p *project) bool { return !c.skip }
+func (c *fakeCheck) Run(p *project) ([]Finding, error) {
+	findings := make([]Finding, 0, len(c.messages))
+	for _, message := range c.messages {
+		findings = append(findings, Finding{Check: c.id, Severity: c.severity, Message: message})
+	}
+	return findings, nil
+}
+
+func TestDoctorReport(t *testing.T) {
+	logger = zap.NewNop()
+	saved := doctorChecks
+	defer func() { doctorChecks = saved }()
+
+	tests := []struct {
+		name     string
+		checks   []Check
+		expected string
+		reached  map[Severity]int // threshold -> findings
+		score    int
+	}{
+		{
+			name:     "ok",
+			checks:   []Check{&fakeCheck{id: "a", severity: SeverityError}},
+			expected: "/foo: OK\n",
+			reached:  map[Severity]int{SeverityInfo: 0, severityNone: 0},
+			score:    100,
+		},
+		{
+			name: "grouped by severity",
+			checks: []Check{
+				&fakeCheck{id: "info", severity: SeverityInfo, messages: []string{"i1"}},
+				&fakeCheck{id: "warn", severity: SeverityWarning, messages: []string{"w1", "w2"}},
+				&fakeCheck{id: "err", severity: SeverityError, messages: []string{"e1"}},
+				&fakeCheck{id: "ok", severity: SeverityError},
+				&fakeCheck{id: "skipped", severity: SeverityError, skip: true, messages: []string{"never"}},
+			},
+			expected: `/foo:
+  error:
+    [err] e1
+  warning:
+    [warn] w1
+    [warn] w2
+  info:
+    [info] i1
+`,
+			reached: map[Severity]int{SeverityInfo: 4, SeverityWarning: 3, SeverityError: 1, severityNone: 0},
+			score:   25,
+		},
+		{
+			name:     "no applicable check",
+			checks:   []Check{&fakeCheck{id: "skipped", skip: true, messages: []string{"never"}}},
+			expected: "/foo: OK\n",
+			reached:  map[Severity]int{SeverityInfo: 0},
+			score:    100,
+		},
+	}
+	for _, tt := range tests {
+		doctorChecks = tt.checks
+		report, err := doDoctorProject(context.Background(), &project{Path: "/foo"})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := report.String(); got != tt.expected {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", tt.name, tt.expected, got)
+		}
+		for threshold, expected := range tt.reached {
+			if got := report.reached(threshold); got != expected {
+				t.Errorf("%s: expected %d finding(s) at or above %s, got %d", tt.name, expected, threshold, got)
+			}
+		}
+		if got := report.score(); got != tt.score {
+			t.Errorf("%s: expected a score of %d, got %d", tt.name, tt.score, got)
+		}
+	}
+
+	// fixed findings are reported, but do not count
+	report := &doctorReport{Path: "/foo", Checks: 2, Findings: []Finding{{Check: "a", Severity: SeverityError, Message: "m", Fixed: true}}}
+	if report.String() != "/foo:\n  error:\n    [a] m (fixed)\n" || report.reached(SeverityInfo) != 0 || report.score() != 100 {
+		t.Errorf("unexpected report for a fixed finding: %q", report.String())
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []string{"info", "WARNING", "error", "none"} {
+		if _, err := parseSeverity(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	if _, err := parseSeverity("fatal"); err == nil {
+		t.Errorf("expected an error for an unknown severity")
+	}
+}
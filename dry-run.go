@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// runWriteCommand opens the project at path and runs fn on it.
+//
+// HEAD and the index are snapshotted first; if fn fails, the worktree is restored according to -on-failure,
+// unless fn returns a changesKeptError.
+// With -dry-run, fn runs on a temporary copy of the repository instead, and the changes made to the copy
+// are written as a patch to stdout, or to -patch-dir; the project itself is never touched.
+func runWriteCommand(ctx context.Context, command, path string, opts projectOpts, fn func(p *project) error) error {
+	project, err := projectFromPath(path)
+	if err != nil {
+		return fmt.Errorf("invalid project: %w", err)
+	}
+	if !opts.DryRun {
+		switch opts.OnFailure {
+		case onFailureRollback, onFailureRescue, onFailureKeep:
+		default:
+			return fmt.Errorf("invalid -on-failure: %q", opts.OnFailure) //nolint:goerr113
+		}
+		snapshot, err := project.snapshot()
+		if err != nil {
+			return fmt.Errorf("snapshot: %w", err)
+		}
+		err = fn(project)
+		var kept *changesKeptError
+		if err != nil && !errors.As(err, &kept) {
+			return project.handleFailure(snapshot, opts.OnFailure, command, err)
+		}
+		return err
+	}
+	if project.Git.Root == "" {
+		return fmt.Errorf("not implemented: dry-run on non-git projects") //nolint:goerr113
+	}
+
+	tmp, err := ioutil.TempDir("", "repoman-dry-run-")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := copyDir(project.Git.Root, tmp); err != nil {
+		return fmt.Errorf("copy project: %w", err)
+	}
+	rel, _ := filepath.Rel(project.Git.Root, project.Path)
+	dryRun, err := projectFromPath(filepath.Join(tmp, rel))
+	if err != nil {
+		return fmt.Errorf("invalid project copy: %w", err)
+	}
+	logger.Info("dry-run", zap.String("project", project.Path), zap.String("copy", dryRun.Path))
+
+	fnErr := fn(dryRun)
+	var kept *changesKeptError
+	if fnErr != nil && !errors.As(fnErr, &kept) {
+		return fnErr
+	}
+
+	patch, err := dryRun.stagedPatch(ctx)
+	if err != nil {
+		return err
+	}
+	if err := project.writePatch(patch, opts.PatchDir); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// stagedPatch stages every change of the worktree and returns them as a patch that can be applied with "git apply".
+func (p *project) stagedPatch(ctx context.Context) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-ec", "git add -A . && git diff --cached --binary")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Dir = p.Git.Root
+	cmd.Env = os.Environ()
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git diff: %w: %s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// patchMutex prevents the patches of the projects processed concurrently from being interleaved on stdout.
+var patchMutex sync.Mutex
+
+// writePatch prints the patch of a project, or writes it in dir as <owner>-<name>.patch.
+func (p *project) writePatch(patch []byte, dir string) error {
+	if len(patch) == 0 {
+		logger.Info("dry-run: nothing changed", zap.String("project", p.Path))
+		return nil
+	}
+	if dir == "" {
+		patchMutex.Lock()
+		defer patchMutex.Unlock()
+		fmt.Printf("# %s\n", p.Path)
+		_, err := os.Stdout.Write(patch)
+		return err
+	}
+
+	name := filepath.Base(p.Path)
+	if p.Git.RepoOwner != "" && p.Git.RepoName != "" {
+		name = p.Git.RepoOwner + "-" + p.Git.RepoName
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("mkdir %q: %w", dir, err)
+	}
+	path := filepath.Join(dir, name+".patch")
+	if err := ioutil.WriteFile(path, patch, 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("write file: %q: %w", path, err)
+	}
+	logger.Info("dry-run: patch written", zap.String("project", p.Path), zap.String("patch", path))
+	return nil
+}
+
+// copyDir recursively copies src into dst, keeping the file modes and the symlinks.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk dir: %q: %w", path, err)
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("stat %q: %w", path, err)
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("readlink %q: %w", path, err)
+			}
+			return os.Symlink(link, target)
+		case !d.Type().IsRegular():
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("open %q: %w", path, err)
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return fmt.Errorf("create %q: %w", target, err)
+		}
+		defer out.Close()
+		if _, err := io.Copy(out, in); err != nil {
+			return fmt.Errorf("copy %q: %w", path, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"go.uber.org/zap"
+	"moul.io/u"
+)
+
+// newTestProject creates a git repository with a committed README.md, and an origin on GitHub.
+func newTestProject(t *testing.T) string {
+	t.Helper()
+	logger = zap.NewNop()
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"git@github.com:bob/foo.git"}}); err != nil {
+		t.Fatal(err)
+	}
+	workTree, _ := repo.Worktree()
+	if _, err := workTree.Add("README.md"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := workTree.Commit("initial", &git.CommitOptions{Author: gitSignature(repo)}); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRunWriteCommandDryRun(t *testing.T) {
+	dir := newTestProject(t)
+	patchDir := filepath.Join(t.TempDir(), "patches")
+	opts := projectOpts{DryRun: true, PatchDir: patchDir}
+	err := runWriteCommand(context.Background(), "test", dir, opts, func(p *project) error {
+		if p.Path == dir {
+			t.Errorf("expected to run on a copy")
+		}
+		if err := ioutil.WriteFile(filepath.Join(p.Path, "README.md"), []byte("world\n"), 0); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(p.Path, "NEW.md"), []byte("new\n"), 0o644)
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "README.md")); string(content) != "hello\n" {
+		t.Errorf("the project was modified: %q", content)
+	}
+	if u.FileExists(filepath.Join(dir, "NEW.md")) {
+		t.Errorf("the project was modified: NEW.md was created")
+	}
+	patch, err := ioutil.ReadFile(filepath.Join(patchDir, "bob-foo.patch"))
+	if err != nil {
+		t.Fatalf("read patch: %v", err)
+	}
+	for _, expected := range []string{"+++ b/NEW.md", "-hello", "+world"} {
+		if !strings.Contains(string(patch), expected) {
+			t.Errorf("expected %q in patch:\n%s", expected, patch)
+		}
+	}
+}
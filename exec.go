@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"moul.io/u"
+)
+
+func doExec(ctx context.Context, args []string) error {
+	paths, command := splitExecArgs(args)
+	if len(command) == 0 {
+		return flag.ErrHelp
+	}
+	title := opts.Exec.Title
+	if title == "" {
+		title = "chore: " + strings.Join(command, " ")
+	}
+	// a script of the current directory can be run in every project
+	if strings.ContainsRune(command[0], os.PathSeparator) && u.FileExists(command[0]) {
+		abs, err := filepath.Abs(command[0])
+		if err != nil {
+			return fmt.Errorf("invalid command: %q: %w", command[0], err)
+		}
+		command[0] = abs
+	}
+	paths, err := targetPaths(paths)
+	if err != nil {
+		return err
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	logger.Debug("doExec", zap.Any("opts", opts), zap.Strings("projects", paths), zap.Strings("command", command))
+
+	var (
+		errs  error
+		mutex sync.Mutex
+	)
+	for _, path := range paths {
+		path := path
+		g.Go(func() error {
+			err := runWriteCommand(ctx, "exec", path, opts.Exec.Project, func(project *project) error {
+				return doExecOnce(ctx, project, command, title)
+			})
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("%q: %w", path, err))
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return errs
+}
+
+// splitExecArgs splits "<path...> -- <command...>".
+//
+// The flag parser consumes a leading "--", so without paths every arg is part of the command,
+// and the projects come from the workspace. The args before "--" are only paths if they are all directories,
+// otherwise the "--" belongs to the command, i.e., "repoman exec git diff -- foo".
+func splitExecArgs(args []string) (paths []string, command []string) {
+	for i, arg := range args {
+		if arg != "--" {
+			continue
+		}
+		for _, path := range args[:i] {
+			if !u.DirExists(path) {
+				return nil, args
+			}
+		}
+		return args[:i], args[i+1:]
+	}
+	return nil, args
+}
+
+func doExecOnce(ctx context.Context, project *project, command []string, title string) error {
+	// prepare workspace
+	{
+		err := project.prepareWorkspace(opts.Exec.Project)
+		if err != nil {
+			return fmt.Errorf("prepare workspace: %w", err)
+		}
+	}
+
+	// run command
+	{
+		var output bytes.Buffer
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		cmd.Dir = project.Path
+		cmd.Env = append(os.Environ(), project.execEnv()...)
+		err := cmd.Run()
+		printExecOutput(project.Path, output.Bytes())
+		if err != nil {
+			return fmt.Errorf("exec failed: %q: %w", cmd.String(), err)
+		}
+	}
+
+	// stage the files created by the command, they would be left out of the commit otherwise
+	{
+		err := runCommandInDir(ctx, project.Git.Root, "git", "add", "-A")
+		if err != nil {
+			return fmt.Errorf("stage changes: %w", err)
+		}
+	}
+
+	// push changes, only when a branch is given
+	{
+		pushOpts := opts.Exec.Project
+		pushOpts.OpenPR = pushOpts.OpenPR && opts.Exec.Branch != ""
+		_, err := project.pushChanges(ctx, pushOpts, opts.Exec.Branch, title)
+		if err != nil {
+			return fmt.Errorf("push changes: %w", err)
+		}
+	}
+	return nil
+}
+
+// execEnv returns the REPOMAN_* variables describing the project, passed to the command run by exec.
+func (p *project) execEnv() []string {
+	vars := []struct{ key, value string }{
+		{"REPOMAN_PATH", p.Path},
+		{"REPOMAN_ROOT", p.Git.Root},
+		{"REPOMAN_OWNER", p.Git.RepoOwner},
+		{"REPOMAN_NAME", p.Git.RepoName},
+		{"REPOMAN_HOST", p.Git.Host},
+		{"REPOMAN_HTML_URL", p.Git.HTMLURL},
+		{"REPOMAN_MAIN_BRANCH", p.Git.MainBranch},
+		{"REPOMAN_GO_MODULE", p.Git.Metadata.GoModPath},
+	}
+	ret := make([]string, 0, len(vars))
+	for _, v := range vars {
+		ret = append(ret, v.key+"="+v.value)
+	}
+	return ret
+}
+
+// execMutex prevents the outputs of the projects processed concurrently from being interleaved.
+var execMutex sync.Mutex
+
+func printExecOutput(path string, output []byte) {
+	execMutex.Lock()
+	defer execMutex.Unlock()
+	fmt.Fprintf(os.Stderr, "%s:\n", path)
+	if len(output) == 0 {
+		return
+	}
+	_, _ = os.Stderr.Write(output)
+	if output[len(output)-1] != '\n' {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+const execLongHelp = `The command runs from the directory of each project, with the following variables:
+REPOMAN_PATH, REPOMAN_ROOT, REPOMAN_OWNER, REPOMAN_NAME, REPOMAN_HOST, REPOMAN_HTML_URL,
+REPOMAN_MAIN_BRANCH and REPOMAN_GO_MODULE.
+
+The files created by the command are staged with the changes.
+A pull-request is opened with the changes only when -branch is given.`
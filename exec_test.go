@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"moul.io/u"
+)
+
+func TestSplitExecArgs(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	tests := []struct {
+		args           []string
+		paths, command []string
+	}{
+		{[]string{a, b, "--", "make", "fmt"}, []string{a, b}, []string{"make", "fmt"}},
+		{[]string{"make", "fmt"}, nil, []string{"make", "fmt"}},
+		{[]string{a, "--"}, []string{a}, []string{}},
+		{[]string{"git", "diff", "--", "foo"}, nil, []string{"git", "diff", "--", "foo"}},
+		{[]string{a, "git", "--", "foo"}, nil, []string{a, "git", "--", "foo"}},
+	}
+	for _, tt := range tests {
+		paths, command := splitExecArgs(tt.args)
+		if !reflect.DeepEqual(paths, tt.paths) || !reflect.DeepEqual(command, tt.command) {
+			t.Errorf("%v: expected %v %v, got %v %v", tt.args, tt.paths, tt.command, paths, command)
+		}
+	}
+}
+
+func TestDoExec(t *testing.T) {
+	dir := newTestProject(t)
+	for _, name := range repomanRequiredFiles {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		out, err := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git("add", "-A")
+	git("commit", "-qm", "setup")
+	saved := opts.Exec
+	defer func() { opts.Exec = saved }()
+	opts.Exec.Project = projectOpts{OnFailure: onFailureRollback}
+	ctx := context.Background()
+
+	// the command runs in the project, with the REPOMAN_* variables
+	err := doExec(ctx, []string{dir, "--", "/bin/sh", "-c", `echo "$REPOMAN_OWNER/$REPOMAN_NAME" > OUT`})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "OUT")); string(content) != "bob/foo\n" {
+		t.Errorf("unexpected output: %q", content)
+	}
+	if opts.Exec.Title != "" {
+		t.Errorf("expected the default title not to be kept for the next commands, got %q", opts.Exec.Title)
+	}
+	if status, _ := exec.Command("git", "-C", dir, "status", "--porcelain").Output(); string(status) != "A  OUT\n" {
+		t.Errorf("expected the new file to be staged, got %q", status)
+	}
+	git("add", "-A")
+	git("commit", "-qm", "out")
+
+	// a failing command is rolled back
+	err = doExec(ctx, []string{dir, "--", "/bin/sh", "-c", "rm OUT && touch NEW && exit 3"})
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("expected the command's error, got %v", err)
+	}
+	if u.FileExists(filepath.Join(dir, "NEW")) || !u.FileExists(filepath.Join(dir, "OUT")) {
+		t.Errorf("expected the worktree to be rolled back")
+	}
+}
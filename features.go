@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+	"moul.io/u"
+)
+
+// templateFeature is an optional part of a template, removed by template-post-clone with its -no-<id> flag.
+type templateFeature struct {
+	ID          string
+	Description string
+	// Files are the globs of the files owned by the feature.
+	Files []string
+	// MakefileVars are the Makefile variables enabling the feature in rules.mk.
+	MakefileVars []string
+	// MakefileTargets are the Makefile targets only used by the feature.
+	MakefileTargets []string
+	// Script is run once all the features are removed, to regenerate the files depending on the feature.
+	Script string
+}
+
+// templateFeatures is the registry of the features that can be removed from a template.
+var templateFeatures = []*templateFeature{
+	{
+		ID:           "binary",
+		Description:  "Go binary",
+		Files:        []string{"main*.go"},
+		MakefileVars: []string{"GOBINS"},
+		// the generate target builds the binary to embed its usage in the README
+		MakefileTargets: []string{"generate"},
+		Script: `
+			main() {
+				make generate go.depaware-update
+				git add AUTHORS README.md depaware.txt
+				make tidy
+				git add go.mod go.sum
+				git status
+			}
+			main
+		`,
+	},
+	{
+		ID:           "docker",
+		Description:  "Docker image",
+		Files:        []string{"Dockerfile", ".dockerignore", ".github/workflows/docker.yml"},
+		MakefileVars: []string{"DOCKER_IMAGE"},
+	},
+	{
+		ID:           "npm",
+		Description:  "npm package",
+		Files:        []string{"package.json", "package-lock.json", ".npmignore"},
+		MakefileVars: []string{"NPM_PACKAGES"},
+	},
+	{
+		ID:          "goreleaser",
+		Description: "GoReleaser config",
+		Files:       []string{".goreleaser.yml", ".goreleaser.yaml"},
+	},
+	{
+		ID:          "gitpod",
+		Description: "Gitpod config",
+		Files:       []string{".gitpod.yml", ".gitpod.Dockerfile"},
+	},
+}
+
+// removeGoBinaryFeatures are the features removed by the legacy -rm-go-binary flag.
+var removeGoBinaryFeatures = []string{"binary", "docker", "npm", "goreleaser"}
+
+// removeGoBinaryFiles are the only files removed by the legacy -rm-go-binary flag, as before the features existed;
+// the Makefile variables and targets of its features are all removed.
+var removeGoBinaryFiles = []string{"main*.go", "Dockerfile", ".goreleaser.yml", ".github/workflows/docker.yml"}
+
+// templateFeatureByID returns the built-in feature with the given ID, or nil.
+func templateFeatureByID(id string) *templateFeature {
+	for _, feature := range templateFeatures {
+		if feature.ID == id {
+			return feature
+		}
+	}
+	return nil
+}
+
+// removedFeatures returns the features disabled with the -no-<id> flags, in registry order.
+//
+// The features removed by -rm-go-binary only, without -no-<id>, are restricted to removeGoBinaryFiles.
+func (opts templateOpts) removedFeatures() []*templateFeature {
+	var ret []*templateFeature
+	for _, feature := range templateFeatures {
+		switch {
+		case opts.NoFeatures[feature.ID] != nil && *opts.NoFeatures[feature.ID]:
+			ret = append(ret, feature)
+		case opts.RemoveGoBinary && containsString(removeGoBinaryFeatures, feature.ID):
+			legacy := *feature
+			legacy.Files = nil
+			for _, file := range feature.Files {
+				if containsString(removeGoBinaryFiles, file) {
+					legacy.Files = append(legacy.Files, file)
+				}
+			}
+			ret = append(ret, &legacy)
+		}
+	}
+	return ret
+}
+
+// featureOwning returns the feature owning a file, or nil.
+func featureOwning(features []*templateFeature, name string) *templateFeature {
+	for _, feature := range features {
+		if matchAnyGlob(feature.Files, name) {
+			return feature
+		}
+	}
+	return nil
+}
+
+// removeFeature deletes the files and Makefile entries owned by a feature, and returns what was removed.
+// The feature's script is left to the caller.
+func (p *project) removeFeature(feature *templateFeature) ([]string, error) {
+	logger.Debug("remove feature", zap.String("feature", feature.ID), zap.String("project", p.Path))
+	var removed []string
+
+	// remove files
+	index, err := p.Git.repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("read git index: %w", err)
+	}
+	for _, pattern := range feature.Files {
+		matches, err := filepath.Glob(filepath.Join(p.Path, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("glob: %w", err)
+		}
+		for _, match := range matches {
+			rel, _ := filepath.Rel(p.Path, match)
+			if _, err := index.Entry(p.gitPath(rel)); err == nil {
+				if _, err := p.Git.workTree.Remove(p.gitPath(rel)); err != nil {
+					return nil, fmt.Errorf("git rm %q: %w", rel, err)
+				}
+			} else if err := os.Remove(match); err != nil {
+				return nil, fmt.Errorf("rm %q: %w", rel, err)
+			}
+			removed = append(removed, rel)
+			for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+				if os.Remove(filepath.Join(p.Path, dir)) != nil { // fails if the directory is not empty
+					break
+				}
+			}
+		}
+	}
+
+	// patch Makefile
+	makefile := filepath.Join(p.Path, "Makefile")
+	if (len(feature.MakefileVars) > 0 || len(feature.MakefileTargets) > 0) && u.FileExists(makefile) {
+		content, err := ioutil.ReadFile(makefile)
+		if err != nil {
+			return nil, fmt.Errorf("read Makefile: %w", err)
+		}
+		newContent := content
+		for _, name := range feature.MakefileVars {
+			re := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(name) + `\s*[:+?]?=.*\n`)
+			if re.Match(newContent) {
+				newContent = re.ReplaceAll(newContent, nil)
+				removed = append(removed, "Makefile: "+name)
+			}
+		}
+		for _, target := range feature.MakefileTargets {
+			re := regexp.MustCompile(`(?ms)^` + regexp.QuoteMeta(target) + `:.*?^\.PHONY: ` + regexp.QuoteMeta(target) + `\n?`)
+			if re.Match(newContent) {
+				newContent = re.ReplaceAll(newContent, nil)
+				removed = append(removed, "Makefile: "+target+" target")
+			}
+		}
+		newContent = regexp.MustCompile(`\n{3,}`).ReplaceAll(newContent, []byte("\n\n"))
+		if string(newContent) != string(content) {
+			if err := ioutil.WriteFile(makefile, newContent, 0); err != nil {
+				return nil, fmt.Errorf("write file: %q: %w", makefile, err)
+			}
+			if _, err := p.Git.workTree.Add(p.gitPath("Makefile")); err != nil {
+				return nil, fmt.Errorf("git add Makefile: %w", err)
+			}
+		}
+	}
+	return removed, nil
+}
+
+// removeFeatures removes the disabled features and prints what was removed,
+// then runs the scripts of the removed features, so that they see the project without any of them.
+func (p *project) removeFeatures(ctx context.Context, features []*templateFeature) error {
+	if len(features) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: removed features:\n", p.Path)
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	var scripts []*templateFeature
+	for _, feature := range features {
+		removed, err := p.removeFeature(feature)
+		if err != nil {
+			return fmt.Errorf("remove %s: %w", feature.ID, err)
+		}
+		if len(removed) == 0 {
+			removed = []string{"nothing to remove"}
+		} else if feature.Script != "" {
+			scripts = append(scripts, feature)
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", feature.ID, strings.Join(removed, ", "))
+	}
+	_ = w.Flush()
+	fmt.Fprint(os.Stderr, b.String())
+
+	for _, feature := range scripts {
+		if err := runCommand(ctx, p, "/bin/sh", "-xec", feature.Script); err != nil {
+			return fmt.Errorf("%s script: %w", feature.ID, err)
+		}
+	}
+	return nil
+}
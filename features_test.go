@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"go.uber.org/zap"
+)
+
+func TestRemoveFeature(t *testing.T) {
+	logger = zap.NewNop()
+	dir := t.TempDir()
+	files := map[string]string{
+		"Dockerfile":  "FROM scratch\n",
+		".gitpod.yml": "tasks: []\n",
+		"Makefile":    "GOPKG ?= moul.io/foo\nDOCKER_IMAGE ?= moul/foo\nGOBINS ?= .\n\ninclude rules.mk\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"git@github.com:bob/foo.git"}}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := projectFromPath(dir)
+	if err != nil {
+		t.Fatalf("project: %v", err)
+	}
+
+	feature := templateFeatureByID("docker")
+	removed, err := p.removeFeature(feature)
+	if err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	expected := []string{"Dockerfile", "Makefile: DOCKER_IMAGE"}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Errorf("expected %v, got %v", expected, removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Dockerfile")); !os.IsNotExist(err) {
+		t.Errorf("expected Dockerfile to be removed")
+	}
+	makefile, _ := ioutil.ReadFile(filepath.Join(dir, "Makefile"))
+	if string(makefile) != "GOPKG ?= moul.io/foo\nGOBINS ?= .\n\ninclude rules.mk\n" {
+		t.Errorf("unexpected Makefile:\n%s", makefile)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".gitpod.yml")); err != nil {
+		t.Errorf("expected .gitpod.yml to be kept")
+	}
+}
+
+func TestRemoveFeaturesScripts(t *testing.T) {
+	logger = zap.NewNop()
+	dir := newTestProject(t)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := projectFromPath(dir)
+	if err != nil {
+		t.Fatalf("project: %v", err)
+	}
+
+	// the script of the first feature only runs once the second one is removed too
+	features := []*templateFeature{
+		{ID: "a", Files: []string{"a.txt"}, Script: "test ! -e b.txt && touch a.done"},
+		{ID: "b", Files: []string{"b.txt"}},
+		{ID: "c", Files: []string{"c.txt"}, Script: "touch c.done"},
+	}
+	if err := p.removeFeatures(context.Background(), features); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.done")); err != nil {
+		t.Errorf("expected the script of a to run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c.done")); !os.IsNotExist(err) {
+		t.Errorf("expected the script of c not to run, nothing was removed")
+	}
+}
+
+func TestRemovedFeatures(t *testing.T) {
+	yes := true
+	opts := templateOpts{RemoveGoBinary: true, NoFeatures: map[string]*bool{"gitpod": &yes}}
+	var ids []string
+	for _, feature := range opts.removedFeatures() {
+		ids = append(ids, feature.ID)
+	}
+	expected := []string{"binary", "docker", "npm", "goreleaser", "gitpod"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+
+	// -rm-go-binary keeps removing the same files as before the features
+	var files, vars []string
+	for _, feature := range opts.removedFeatures() {
+		if feature.ID != "gitpod" {
+			files = append(files, feature.Files...)
+			vars = append(vars, feature.MakefileVars...)
+		}
+	}
+	if !reflect.DeepEqual(files, []string{"main*.go", "Dockerfile", ".github/workflows/docker.yml", ".goreleaser.yml"}) {
+		t.Errorf("unexpected files for -rm-go-binary: %v", files)
+	}
+	if !reflect.DeepEqual(vars, []string{"GOBINS", "DOCKER_IMAGE", "NPM_PACKAGES"}) {
+		t.Errorf("unexpected Makefile variables for -rm-go-binary: %v", vars)
+	}
+
+	// -no-<id> removes all the files of the feature
+	opts.NoFeatures["npm"] = &yes
+	for _, feature := range opts.removedFeatures() {
+		if feature.ID == "npm" && !reflect.DeepEqual(feature.Files, templateFeatureByID("npm").Files) {
+			t.Errorf("unexpected files for -no-npm: %v", feature.Files)
+		}
+	}
+}
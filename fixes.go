@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"moul.io/u"
+)
+
+// renovateConfigMisplaced returns whether renovate.json should be moved to .github/, unless either is excluded.
+func renovateConfigMisplaced(p *project) bool {
+	return u.FileExists(filepath.Join(p.Path, "renovate.json")) && !p.isExcluded("renovate.json") && !p.isExcluded(".github/renovate.json")
+}
+
+// moveRenovateConfig moves renovate.json to .github/renovate.json, or removes it if the latter already exists.
+func moveRenovateConfig(p *project) error {
+	if !renovateConfigMisplaced(p) {
+		return nil
+	}
+	if u.FileExists(filepath.Join(p.Path, ".github", "renovate.json")) {
+		if _, err := p.Git.workTree.Remove(p.gitPath("renovate.json")); err != nil {
+			return fmt.Errorf("git rm renovate.json: %w", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(p.Path, ".github"), 0o755); err != nil {
+		return fmt.Errorf("mkdir .github: %w", err)
+	}
+	if _, err := p.Git.workTree.Move(p.gitPath("renovate.json"), p.gitPath(".github/renovate.json")); err != nil {
+		return fmt.Errorf("git mv renovate.json: %w", err)
+	}
+	return nil
+}
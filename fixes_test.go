@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"moul.io/u"
+)
+
+func TestDoctorFixRenovateLocation(t *testing.T) {
+	for _, existing := range []bool{false, true} {
+		dir := newTestProject(t)
+		files := append([]string{"renovate.json"}, repomanRequiredFiles...)
+		if existing {
+			if err := os.MkdirAll(filepath.Join(dir, ".github"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, ".github/renovate.json")
+		}
+		for _, name := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("{}\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, args := range [][]string{{"add", "-A"}, {"commit", "-qm", "setup"}} {
+			out, err := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...).CombinedOutput()
+			if err != nil {
+				t.Fatalf("git %v: %v: %s", args, err, out)
+			}
+		}
+
+		saved := opts.Doctor
+		opts.Doctor.Fix = true
+		opts.Doctor.Project = projectOpts{OnFailure: onFailureRollback}
+		report, err := doDoctorOnce(context.Background(), dir)
+		opts.Doctor = saved
+		if err != nil {
+			t.Fatalf("existing=%v: doctor: %v", existing, err)
+		}
+
+		var found bool
+		for _, finding := range report.Findings {
+			if finding.Check != "renovate-location" {
+				continue
+			}
+			found = true
+			if !finding.Fixed {
+				t.Errorf("existing=%v: expected the finding to be marked as fixed", existing)
+			}
+		}
+		if !found {
+			t.Errorf("existing=%v: expected a renovate-location finding", existing)
+		}
+		if u.FileExists(filepath.Join(dir, "renovate.json")) || !u.FileExists(filepath.Join(dir, ".github", "renovate.json")) {
+			t.Errorf("existing=%v: expected renovate.json to be moved to .github/", existing)
+		}
+
+		// the finding is gone
+		project, err := projectFromPath(dir)
+		if err != nil {
+			t.Fatalf("project: %v", err)
+		}
+		if findings, _ := doctorCheckByID(t, "renovate-location").Run(project); len(findings) != 0 {
+			t.Errorf("existing=%v: expected no more finding, got %v", existing, findings)
+		}
+	}
+}
+
+func doctorCheckByID(t *testing.T, id string) Check {
+	t.Helper()
+	for _, check := range doctorChecks {
+		if check.ID() == id {
+			return check
+		}
+	}
+	t.Fatalf("unknown check: %q", id)
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// forgeKind is the flavor of the service hosting a git repository.
+type forgeKind string
+
+const (
+	forgeGitHub    forgeKind = "github"
+	forgeGitLab    forgeKind = "gitlab"
+	forgeGitea     forgeKind = "gitea"
+	forgeBitbucket forgeKind = "bitbucket"
+	forgeLocal     forgeKind = "local"
+	forgeUnknown   forgeKind = "unknown"
+)
+
+// forgeRepo describes a repository hosted on a forge, as guessed from its clone URL.
+type forgeRepo struct {
+	Kind    forgeKind
+	Host    string
+	Owner   string // may contain slashes, i.e., nested GitLab groups
+	Name    string
+	HTMLURL string
+}
+
+// scpLikeURLRegex matches the "user@host:path" syntax supported by git.
+var scpLikeURLRegex = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// parseForgeRepo extracts the forge, owner and name of a repository from one of its clone URLs.
+//
+// The kind of forge is guessed from the hostname, hint is used instead when not empty.
+func parseForgeRepo(cloneURL string, hint forgeKind) (*forgeRepo, error) {
+	var (
+		scheme   = "https"
+		host     string
+		repoPath string
+	)
+	switch {
+	case strings.Contains(cloneURL, "://"):
+		parsed, err := url.Parse(cloneURL)
+		if err != nil {
+			return nil, fmt.Errorf("parse URL: %q: %w", cloneURL, err)
+		}
+		switch parsed.Scheme {
+		case "file":
+			repoPath = parsed.Path
+		case "http", "https":
+			scheme = parsed.Scheme
+			host = parsed.Host // keep the port, the web UI is served on the same one
+			repoPath = parsed.Path
+		default: // ssh, git
+			host = parsed.Hostname()
+			repoPath = parsed.Path
+		}
+	case strings.HasPrefix(cloneURL, "/") || strings.HasPrefix(cloneURL, "."):
+		repoPath = cloneURL
+	case scpLikeURLRegex.MatchString(cloneURL):
+		match := scpLikeURLRegex.FindStringSubmatch(cloneURL)
+		host = match[1]
+		repoPath = match[2]
+	default:
+		return nil, fmt.Errorf("unsupported clone URL: %q", cloneURL) //nolint:goerr113
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if host == "" {
+		return &forgeRepo{
+			Kind:  forgeLocal,
+			Owner: path.Base(path.Dir(repoPath)),
+			Name:  path.Base(repoPath),
+		}, nil
+	}
+
+	parts := strings.Split(repoPath, "/")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("cannot guess owner and name from clone URL: %q", cloneURL) //nolint:goerr113
+	}
+	ret := &forgeRepo{
+		Kind:  hint,
+		Host:  host,
+		Owner: strings.Join(parts[:len(parts)-1], "/"),
+		Name:  parts[len(parts)-1],
+	}
+	if ret.Kind == "" {
+		ret.Kind = guessForgeKind(host)
+	}
+	ret.HTMLURL = fmt.Sprintf("%s://%s/%s/%s", scheme, host, ret.Owner, ret.Name)
+	return ret, nil
+}
+
+func guessForgeKind(host string) forgeKind {
+	host = strings.ToLower(host)
+	switch {
+	case host == "github.com" || strings.Contains(host, "github"):
+		return forgeGitHub
+	case host == "gitlab.com" || strings.Contains(host, "gitlab"):
+		return forgeGitLab
+	case host == "bitbucket.org" || strings.Contains(host, "bitbucket"):
+		return forgeBitbucket
+	case host == "codeberg.org" || strings.Contains(host, "gitea") || strings.Contains(host, "forgejo"):
+		return forgeGitea
+	default:
+		return forgeUnknown
+	}
+}
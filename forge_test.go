@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseForgeRepo(t *testing.T) {
+	cases := []struct {
+		cloneURL string
+		hint     forgeKind
+		expected forgeRepo
+	}{
+		{"git@github.com:moul/repoman", "", forgeRepo{forgeGitHub, "github.com", "moul", "repoman", "https://github.com/moul/repoman"}},
+		{"https://github.com/moul/repoman.git", "", forgeRepo{forgeGitHub, "github.com", "moul", "repoman", "https://github.com/moul/repoman"}},
+		{"ssh://git@gitlab.com/group/subgroup/project.git", "", forgeRepo{forgeGitLab, "gitlab.com", "group/subgroup", "project", "https://gitlab.com/group/subgroup/project"}},
+		{"https://gitlab.example.com:8443/a/b/c/d", "", forgeRepo{forgeGitLab, "gitlab.example.com:8443", "a/b/c", "d", "https://gitlab.example.com:8443/a/b/c/d"}},
+		{"git@bitbucket.org:team/repo.git", "", forgeRepo{forgeBitbucket, "bitbucket.org", "team", "repo", "https://bitbucket.org/team/repo"}},
+		{"https://codeberg.org/moul/repoman", "", forgeRepo{forgeGitea, "codeberg.org", "moul", "repoman", "https://codeberg.org/moul/repoman"}},
+		{"ssh://git@git.example.com:2222/moul/repoman.git", "", forgeRepo{forgeUnknown, "git.example.com", "moul", "repoman", "https://git.example.com/moul/repoman"}},
+		{"ssh://git@git.example.com:2222/moul/repoman.git", forgeGitea, forgeRepo{forgeGitea, "git.example.com", "moul", "repoman", "https://git.example.com/moul/repoman"}},
+		{"/srv/git/moul/repoman.git", "", forgeRepo{Kind: forgeLocal, Owner: "moul", Name: "repoman"}},
+		{"file:///srv/git/moul/repoman", "", forgeRepo{Kind: forgeLocal, Owner: "moul", Name: "repoman"}},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.cloneURL, func(t *testing.T) {
+			ret, err := parseForgeRepo(tc.cloneURL, tc.hint)
+			if err != nil {
+				t.Fatalf("err should be nil: %v", err)
+			}
+			if *ret != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, *ret)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"github.com", "https://github.com/moul"} {
+		if _, err := parseForgeRepo(invalid, ""); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
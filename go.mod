@@ -3,17 +3,13 @@ module moul.io/repoman
 go 1.13
 
 require (
-	github.com/BurntSushi/toml v1.3.2 // indirect
 	github.com/Masterminds/semver v1.5.0
 	github.com/fatih/color v1.15.0 // indirect
-	github.com/github/hub/v2 v2.14.3-0.20210319163717-c8e68d548a39
 	github.com/go-git/go-git/v5 v5.8.1
 	github.com/google/go-github/v35 v35.3.0
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/hokaccha/go-prettyjson v0.0.0-20211117102719-0474bc63780f
-	github.com/kballard/go-shellquote v0.0.0-20180428030007-95032a82bc51 // indirect
-	github.com/mattn/go-isatty v0.0.19 // indirect
-	github.com/mitchellh/go-homedir v1.1.0 // indirect
+	github.com/mattn/go-isatty v0.0.19
 	github.com/peterbourgon/ff/v3 v3.4.0
 	github.com/sergi/go-diff v1.3.1 // indirect
 	github.com/tailscale/depaware v0.0.0-20210622194025-720c4b409502
@@ -24,8 +20,8 @@ require (
 	golang.org/x/mod v0.12.0
 	golang.org/x/sync v0.3.0
 	golang.org/x/tools v0.11.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 	moul.io/motd v1.0.0
-	moul.io/multipmuri v1.14.0
 	moul.io/srand v1.6.1
 	moul.io/u v1.27.0
 	moul.io/zapconfig v1.4.0
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// modulePathFromRule returns the module path of a project, rule can contain the {owner} and {name} placeholders.
+func modulePathFromRule(rule string, p *project) string {
+	return strings.NewReplacer("{owner}", p.Git.RepoOwner, "{name}", p.Git.RepoName).Replace(rule)
+}
+
+// moduleRewriter replaces a Go module path, and the paths of its packages, with another one.
+type moduleRewriter struct {
+	From string
+	To   string
+}
+
+// rewritePath returns the new import path, and whether it belongs to the rewritten module.
+func (m *moduleRewriter) rewritePath(path string) (string, bool) {
+	if m == nil || m.From == "" || m.From == m.To {
+		return path, false
+	}
+	if path == m.From {
+		return m.To, true
+	}
+	if strings.HasPrefix(path, m.From+"/") {
+		return m.To + path[len(m.From):], true
+	}
+	return path, false
+}
+
+// rewriteGoMod replaces the module path, and the requirements on the module's packages, of a go.mod file.
+func rewriteGoMod(content []byte, modules *moduleRewriter) ([]byte, int, error) {
+	file, err := modfile.Parse("go.mod", content, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parse go.mod: %w", err)
+	}
+	count := 0
+	if file.Module != nil {
+		if path, ok := modules.rewritePath(file.Module.Mod.Path); ok {
+			if err := file.AddModuleStmt(path); err != nil {
+				return nil, 0, fmt.Errorf("set module path: %w", err)
+			}
+			count++
+		}
+	}
+	// DropRequire and DropReplace reset the dropped entries, so iterate over copies
+	requires := make([]modfile.Require, 0, len(file.Require))
+	for _, req := range file.Require {
+		requires = append(requires, *req)
+	}
+	replaces := make([]modfile.Replace, 0, len(file.Replace))
+	for _, rep := range file.Replace {
+		replaces = append(replaces, *rep)
+	}
+	for _, req := range requires {
+		if path, ok := modules.rewritePath(req.Mod.Path); ok {
+			if err := file.DropRequire(req.Mod.Path); err != nil {
+				return nil, 0, fmt.Errorf("drop require: %w", err)
+			}
+			file.AddNewRequire(path, req.Mod.Version, req.Indirect)
+			count++
+		}
+	}
+	for _, rep := range replaces {
+		if path, ok := modules.rewritePath(rep.Old.Path); ok {
+			if err := file.DropReplace(rep.Old.Path, rep.Old.Version); err != nil {
+				return nil, 0, fmt.Errorf("drop replace: %w", err)
+			}
+			if err := file.AddReplace(path, rep.Old.Version, rep.New.Path, rep.New.Version); err != nil {
+				return nil, 0, fmt.Errorf("add replace: %w", err)
+			}
+			count++
+		}
+	}
+	if count == 0 {
+		return content, 0, nil
+	}
+	file.Cleanup()
+	file.SortBlocks()
+	ret, err := file.Format()
+	if err != nil {
+		return nil, 0, fmt.Errorf("format go.mod: %w", err)
+	}
+	return ret, count, nil
+}
+
+var importCommentRegex = regexp.MustCompile(`^package\s+\w+\s*//\s*import\s+("[^"]*")`)
+
+// rewriteGoFile rewrites the import paths of a Go file with modules, and the rest of the file with rewriter.
+//
+// Import paths, including the canonical import comment, are never touched by rewriter,
+// so that dependencies sharing a name with the template keep their path. In the rest of the file,
+// only the module path and the template's name are replaced, not the template's owner alone.
+func rewriteGoFile(content []byte, rewriter *templateRewriter, modules *moduleRewriter) ([]byte, map[string]int, error) {
+	rewriter = rewriter.forGoCode(modules)
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse: %w", err)
+	}
+
+	// collect the import path literals
+	type literal struct{ start, end int }
+	var literals []literal
+	for _, spec := range file.Imports {
+		literals = append(literals, literal{fset.Position(spec.Path.Pos()).Offset, fset.Position(spec.Path.End()).Offset})
+	}
+	pkgOffset := fset.Position(file.Package).Offset
+	lineEnd := strings.IndexByte(string(content[pkgOffset:]), '\n')
+	if lineEnd == -1 {
+		lineEnd = len(content) - pkgOffset
+	}
+	if match := importCommentRegex.FindSubmatchIndex(content[pkgOffset : pkgOffset+lineEnd]); match != nil {
+		literals = append([]literal{{pkgOffset + match[2], pkgOffset + match[3]}}, literals...)
+	}
+
+	var (
+		b      strings.Builder
+		counts = map[string]int{}
+		last   = 0
+	)
+	rewrite := func(s string) {
+		newS, segmentCounts := rewriter.rewriteCount(s)
+		for k, v := range segmentCounts {
+			counts[k] += v
+		}
+		b.WriteString(newS)
+	}
+	for _, lit := range literals {
+		rewrite(string(content[last:lit.start]))
+		raw := string(content[lit.start:lit.end])
+		path, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid import path %s: %w", raw, err)
+		}
+		if newPath, ok := modules.rewritePath(path); ok {
+			raw = strconv.Quote(newPath)
+			counts[modules.From]++
+		}
+		b.WriteString(raw)
+		last = lit.end
+	}
+	rewrite(string(content[last:]))
+
+	if len(counts) == 0 {
+		return content, nil, nil
+	}
+	formatted, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("format: %w", err)
+	}
+	return formatted, counts, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRewriteGoFile(t *testing.T) {
+	p := &project{}
+	p.Git.RepoName = "foo-bar"
+	p.Git.RepoOwner = "bob"
+	rewriter := newTemplateRewriter(p, "golang-repo-template", "moul")
+	modules := &moduleRewriter{From: "moul.io/golang-repo-template", To: modulePathFromRule("github.com/{owner}/{name}", p)}
+
+	input := `// Package golangrepotemplate is a template.
+package golang_repo_template // import "moul.io/golang-repo-template"
+
+import (
+	"fmt"
+
+	tpl "moul.io/golang-repo-template/internal/tpl"
+	"moul.io/u"
+)
+
+// GolangRepoTemplate says hello to moul, see https://moul.io/u.
+func GolangRepoTemplate() {
+	fmt.Println(u.ShortDuration, tpl.X, "golang-repo-template", "moul.io/golang-repo-template/cmd", "moul.io/u")
+}
+`
+	expected := `// Package golangrepotemplate is a template.
+package foo_bar // import "github.com/bob/foo-bar"
+
+import (
+	"fmt"
+
+	tpl "github.com/bob/foo-bar/internal/tpl"
+	"moul.io/u"
+)
+
+// FooBar says hello to moul, see https://moul.io/u.
+func FooBar() {
+	fmt.Println(u.ShortDuration, tpl.X, "foo-bar", "github.com/bob/foo-bar/cmd", "moul.io/u")
+}
+`
+	output, counts, err := rewriteGoFile([]byte(input), rewriter, modules)
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if string(output) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output)
+	}
+	if counts["moul.io/golang-repo-template"] != 3 || counts["moul"] != 0 {
+		t.Errorf("expected 2 import paths and a module path to be rewritten, got %v", counts)
+	}
+}
+
+func TestRewriteGoMod(t *testing.T) {
+	modules := &moduleRewriter{From: "moul.io/golang-repo-template", To: "moul.io/foo"}
+	input := `module moul.io/golang-repo-template/sub
+
+go 1.16
+
+require (
+	moul.io/golang-repo-template v1.0.0
+	moul.io/u v1.27.0
+)
+
+replace moul.io/golang-repo-template => ../
+`
+	expected := `module moul.io/foo/sub
+
+go 1.16
+
+require (
+	moul.io/foo v1.0.0
+	moul.io/u v1.27.0
+)
+
+replace moul.io/foo => ../
+`
+	output, count, err := rewriteGoMod([]byte(input), modules)
+	if err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if string(output) != expected || count != 3 {
+		t.Errorf("expected %d changes:\n%s\ngot %d:\n%s", 3, expected, count, output)
+	}
+}
+
+func TestRewriteTemplateFile(t *testing.T) {
+	logger = zap.NewNop()
+	p := &project{}
+	p.Git.RepoName = "foo"
+	p.Git.RepoOwner = "bob"
+	rewriter := newTemplateRewriter(p, "golang-repo-template", "moul")
+	modules := &moduleRewriter{From: "moul.io/golang-repo-template", To: "moul.io/foo"}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		reason   string
+	}{
+		{"README.md", "# golang-repo-template by moul\n", "# foo by bob\n", ""},
+		{"go.mod", "module moul.io/golang-repo-template\n\nrequire moul.io/u v1.0.0\n", "module moul.io/foo\n\nrequire moul.io/u v1.0.0\n", ""},
+		{"go.sum", "moul.io/u v1.0.0 h1:x\n", "moul.io/u v1.0.0 h1:x\n", "checksums"},
+		{"main.go", "package main\n\nimport \"moul.io/u\"\n\nvar _ = \"moul\"\n", "package main\n\nimport \"moul.io/u\"\n\nvar _ = \"moul\"\n", ""},
+		// the text rewriter would change the imports
+		{"broken.go", "package main\n\nimport moul.io/u\n", "package main\n\nimport moul.io/u\n", "invalid Go file"},
+	}
+	for _, tt := range tests {
+		output, _, reason, err := rewriteTemplateFile(tt.name, []byte(tt.input), rewriter, modules)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(output) != tt.expected || reason != tt.reason {
+			t.Errorf("%s: expected %q (%q), got %q (%q)", tt.name, tt.expected, tt.reason, output, reason)
+		}
+	}
+}
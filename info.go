@@ -2,29 +2,33 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
+	"sync"
 
 	"github.com/hokaccha/go-prettyjson"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
-	"moul.io/u"
 )
 
 func doInfo(ctx context.Context, args []string) error {
-	if len(args) < 1 {
-		return flag.ErrHelp
+	paths, err := targetPaths(args)
+	if err != nil {
+		return err
 	}
-	paths := u.UniqueStrings(args)
 	logger.Debug("doInfo", zap.Any("opts", opts), zap.Strings("project", paths))
 
-	var errs error
+	var (
+		errs  error
+		mutex sync.Mutex
+	)
 	g, ctx := errgroup.WithContext(ctx)
 	for _, path := range paths {
 		path := path
 		g.Go(func() error {
 			err := doInfoOnce(ctx, path)
+			mutex.Lock()
+			defer mutex.Unlock()
 			if err != nil {
 				errs = multierr.Append(errs, fmt.Errorf("%q: %w", path, err))
 			}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"strings"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"go.uber.org/zap"
@@ -29,23 +30,83 @@ type projectOpts struct {
 	ShowDiff           bool
 	OpenPR             bool
 	Reset              bool
+	Force              bool
+	DryRun             bool
+	PatchDir           string
+	OnFailure          string
+}
+
+type templateOpts struct {
+	TemplateName   string
+	TemplateOwner  string
+	RemoveGoBinary bool
+	NoFeatures     map[string]*bool
+	Exclude        string
+	MaxFileSize    int64
+	ModulePath     string
+	Set            stringSliceFlag
 }
 
 type Opts struct {
 	Verbose     bool
+	Workspace   workspaceOpts
 	Path        string
+	Year        int
 	Maintenance struct {
-		Project  projectOpts
-		BumpDeps bool
-		Standard bool
+		Project     projectOpts
+		BumpDeps    bool
+		GoBin       string
+		Include     string
+		Exclude     string
+		Standard    bool
+		Only        string
+		Skip        string
+		TemplateDir string
+		RulesMkDir  string
 	}
 	TemplatePostClone struct {
-		Project        projectOpts
-		RemoveGoBinary bool
-		TemplateName   string
-		TemplateOwner  string
+		Project  projectOpts
+		Template templateOpts
+	}
+	New struct {
+		Template templateOpts
+		Source   string
+		Dir      string
+		Origin   string
+	}
+	TemplateSync struct {
+		Project       projectOpts
+		Template      string
+		Base          string
+		Ref           string
+		TemplateName  string
+		TemplateOwner string
+	}
+	Doctor struct {
+		Project projectOpts
+		FailOn  string
+		Fix     bool
+	}
+	Clone struct {
+		Owner        string
+		Into         string
+		SkipArchived bool
+		SkipForks    bool
+		Layout       string
+		SSH          bool
+		Jobs         int
+	}
+	Exec struct {
+		Project projectOpts
+		Branch  string
+		Title   string
+	}
+	Status struct {
+		Sort    string
+		Reverse bool
+		Filter  string
+		PRs     bool
 	}
-	Doctor  struct{}
 	Info    struct{}
 	Version struct{}
 }
@@ -57,6 +118,12 @@ var (
 	maintenanceFs       = flag.NewFlagSet("maintenance", flag.ExitOnError)
 	versionFs           = flag.NewFlagSet("version", flag.ExitOnError)
 	templatePostCloneFs = flag.NewFlagSet("template-post-clone", flag.ExitOnError)
+	templateSyncFs      = flag.NewFlagSet("template-sync", flag.ExitOnError)
+	newFs               = flag.NewFlagSet("new", flag.ExitOnError)
+	discoverFs          = flag.NewFlagSet("discover", flag.ExitOnError)
+	cloneFs             = flag.NewFlagSet("clone", flag.ExitOnError)
+	execFs              = flag.NewFlagSet("exec", flag.ExitOnError)
+	statusFs            = flag.NewFlagSet("status", flag.ExitOnError)
 	assetsConfigFs      = flag.NewFlagSet("assets-config", flag.ExitOnError)
 	opts                Opts
 
@@ -74,15 +141,82 @@ func run(args []string) error {
 			fs.BoolVar(&opts.ShowDiff, "show-diff", true, "display git diff of the changes")
 			fs.BoolVar(&opts.OpenPR, "open-pr", true, "open a new pull-request with the changes")
 			fs.BoolVar(&opts.Reset, "reset", false, "reset dirty worktree before applying the changes")
+			fs.BoolVar(&opts.Force, "force", false, "overwrite the remote branch instead of appending to its opened pull-request")
+			fs.BoolVar(&opts.DryRun, "dry-run", false, "apply the changes to a temporary copy and print them as a patch, without touching the project")
+			fs.StringVar(&opts.OnFailure, "on-failure", onFailureRollback, "what to do with the changes when the command fails: rollback, rescue (commit them on a rescue branch first), or keep")
+			fs.StringVar(&opts.PatchDir, "patch-dir", "", "with -dry-run, write a <owner>-<name>.patch file per project in this directory instead of stdout")
+		}
+		setupTemplateFlags := func(fs *flag.FlagSet, opts *templateOpts) {
+			fs.StringVar(&opts.TemplateName, "template-name", "golang-repo-template", "template's name (to change with the new project's name)")
+			fs.StringVar(&opts.TemplateOwner, "template-owner", "moul", "template owner's name (to change with the new owner)")
+			fs.BoolVar(&opts.RemoveGoBinary, "rm-go-binary", false, "only keep a library: remove "+strings.Join(removeGoBinaryFiles, ", ")+" and the Makefile variables of -no-"+strings.Join(removeGoBinaryFeatures, " -no-"))
+			opts.NoFeatures = map[string]*bool{}
+			for _, feature := range templateFeatures {
+				opts.NoFeatures[feature.ID] = fs.Bool("no-"+feature.ID, false, fmt.Sprintf("remove the %s and everything related to it", feature.Description))
+			}
+			fs.StringVar(&opts.Exclude, "exclude", "", "comma-separated list of globs to never rewrite, in addition to the manifest's exclude list")
+			fs.StringVar(&opts.ModulePath, "module-path", "moul.io/{name}", "Go module path of the new project, {owner} and {name} are replaced")
+			fs.Int64Var(&opts.MaxFileSize, "max-file-size", 1<<20, "do not rewrite files bigger than this size in bytes (0 for no limit)")
+			fs.Var(&opts.Set, "set", "key=value for a variable or a feature of the template's manifest, can be repeated")
+		}
+		setupWorkspaceFlags := func(fs *flag.FlagSet) {
+			fs.StringVar(&opts.Workspace.Path, "workspace", "", "workspace file listing the repos to target, in addition to the paths (defaults to ./"+workspaceFilename+" or ~/.config/repoman/workspace.yml with -tag)")
+			fs.StringVar(&opts.Workspace.Tags, "tag", "", "comma-separated list of tags, only target the workspace repos having one of them")
+		}
+		setupDiscoverFlags := func(fs *flag.FlagSet) {
+			fs.IntVar(&opts.Workspace.MaxDepth, "max-depth", 3, "maximum depth of the directories walked to find repositories (0 for no limit)")
+			fs.StringVar(&opts.Workspace.Ignore, "ignore", "node_modules,vendor,.*", "comma-separated list of globs of directories to skip when looking for repositories")
+		}
+		for _, fs := range []*flag.FlagSet{infoFs, doctorFs, maintenanceFs, templatePostCloneFs, templateSyncFs, assetsConfigFs, execFs, statusFs} {
+			setupWorkspaceFlags(fs)
+		}
+		for _, fs := range []*flag.FlagSet{infoFs, doctorFs, maintenanceFs, execFs, statusFs} {
+			fs.BoolVar(&opts.Workspace.Recursive, "recursive", false, "target the git repositories found under the paths, instead of the paths")
+			setupDiscoverFlags(fs)
 		}
+		setupDiscoverFlags(discoverFs)
+		cloneFs.StringVar(&opts.Clone.Owner, "owner", "", "GitHub organization or user whose repos are cloned")
+		cloneFs.StringVar(&opts.Clone.Into, "into", ".", "directory where the repos are cloned")
+		cloneFs.BoolVar(&opts.Clone.SkipArchived, "skip-archived", false, "do not clone archived repos")
+		cloneFs.BoolVar(&opts.Clone.SkipForks, "skip-forks", false, "do not clone forks")
+		cloneFs.StringVar(&opts.Clone.Layout, "layout", cloneLayoutName, "where to clone the repos in -into: name, owner/name, or module (the Go module path, like in a GOPATH)")
+		cloneFs.BoolVar(&opts.Clone.SSH, "ssh", false, "clone with SSH instead of HTTPS")
+		cloneFs.IntVar(&opts.Clone.Jobs, "jobs", 8, "maximum number of repos cloned or fetched concurrently (0 for no limit)")
 		rootFs.BoolVar(&opts.Verbose, "v", false, "verbose mode")
 		setupProjectFlags(templatePostCloneFs, &opts.TemplatePostClone.Project)
-		templatePostCloneFs.StringVar(&opts.TemplatePostClone.TemplateName, "template-name", "golang-repo-template", "template's name (to change with the new project's name)")
-		templatePostCloneFs.StringVar(&opts.TemplatePostClone.TemplateOwner, "template-owner", "moul", "template owner's name (to change with the new owner)")
-		templatePostCloneFs.BoolVar(&opts.TemplatePostClone.RemoveGoBinary, "rm-go-binary", false, "whether to delete everything related to go binary and only keep a library")
+		setupTemplateFlags(templatePostCloneFs, &opts.TemplatePostClone.Template)
+		setupTemplateFlags(newFs, &opts.New.Template)
+		newFs.StringVar(&opts.New.Source, "template", "moul/golang-repo-template", "local clone, URL or GitHub owner/name of the template")
+		newFs.StringVar(&opts.New.Dir, "dir", "", "directory of the new project (defaults to ./<name>)")
+		newFs.StringVar(&opts.New.Origin, "origin", "", "URL of the 'origin' remote (defaults to git@github.com:<owner>/<name>.git)")
+		setupProjectFlags(templateSyncFs, &opts.TemplateSync.Project)
+		templateSyncFs.StringVar(&opts.TemplateSync.Template, "template", "", "local clone, URL or GitHub owner/name of the template (defaults to the manifest's template)")
+		templateSyncFs.StringVar(&opts.TemplateSync.Base, "base", "", "template commit the project was generated from or last synced with (defaults to the manifest's template-commit)")
+		templateSyncFs.StringVar(&opts.TemplateSync.Ref, "ref", "HEAD", "template revision to sync with")
+		templateSyncFs.StringVar(&opts.TemplateSync.TemplateName, "template-name", "golang-repo-template", "template's name (to change with the project's name)")
+		templateSyncFs.StringVar(&opts.TemplateSync.TemplateOwner, "template-owner", "moul", "template owner's name (to change with the project's owner)")
 		setupProjectFlags(maintenanceFs, &opts.Maintenance.Project)
 		maintenanceFs.BoolVar(&opts.Maintenance.BumpDeps, "bump-deps", false, "bump dependencies")
+		maintenanceFs.StringVar(&opts.Maintenance.GoBin, "go-bin", "", "go binary used to bump dependencies (defaults to \"go\", overridable by repoman.yml)")
+		maintenanceFs.StringVar(&opts.Maintenance.Include, "bump-deps-include", "", "comma-separated list of module dirs to bump, globs are supported (defaults to all)")
+		maintenanceFs.StringVar(&opts.Maintenance.Exclude, "bump-deps-exclude", "", "comma-separated list of module dirs to skip, globs are supported")
 		maintenanceFs.BoolVar(&opts.Maintenance.Standard, "std", true, "standard maintenance tasks")
+		maintenanceFs.StringVar(&opts.Maintenance.Only, "only", "", "comma-separated list of tasks to run, ignoring -std and -bump-deps")
+		maintenanceFs.StringVar(&opts.Maintenance.Skip, "skip", "", "comma-separated list of tasks to skip")
+		maintenanceFs.StringVar(&opts.Maintenance.TemplateDir, "template-dir", "~/go/src/moul.io/golang-repo-template", "local clone of the template used as reference")
+		maintenanceFs.IntVar(&opts.Year, "year", 0, "year used to update copyright statements (defaults to the current year)")
+		maintenanceFs.StringVar(&opts.Maintenance.RulesMkDir, "rules-mk-dir", "~/go/src/moul.io/rules.mk", "local clone of rules.mk")
+		setupProjectFlags(execFs, &opts.Exec.Project)
+		execFs.StringVar(&opts.Exec.Branch, "branch", "", "branch of the pull-request opened with the changes (no pull-request without it)")
+		execFs.StringVar(&opts.Exec.Title, "title", "", "title of the pull-request and commit message (defaults to \"chore: <command>\")")
+		statusFs.StringVar(&opts.Status.Sort, "sort", "path", "column to sort by: path, branch, dirty, ahead, behind, age, pr, or score")
+		statusFs.BoolVar(&opts.Status.Reverse, "reverse", false, "reverse the sort order")
+		statusFs.StringVar(&opts.Status.Filter, "filter", "", "comma-separated list of conditions the repos must match: dirty, clean, off-main, ahead, behind, pr, or failing")
+		statusFs.BoolVar(&opts.Status.PRs, "prs", true, "look up the opened repoman pull-requests through the GitHub API")
+		setupProjectFlags(doctorFs, &opts.Doctor.Project)
+		doctorFs.BoolVar(&opts.Doctor.Fix, "fix", false, "fix the findings when possible, and push the changes (write)")
+		doctorFs.IntVar(&opts.Year, "year", 0, "year expected in copyright statements (defaults to the current year)")
+		doctorFs.StringVar(&opts.Doctor.FailOn, "fail-on", "error", "exit with an error if a finding has this severity or above (info, warning, error, none)")
 	}
 
 	root := &ffcli.Command{
@@ -90,12 +224,18 @@ func run(args []string) error {
 		FlagSet:    rootFs,
 		ShortUsage: "repoman <subcommand>",
 		Subcommands: []*ffcli.Command{
-			{Name: "info", Exec: doInfo, FlagSet: infoFs, ShortHelp: "get project info", ShortUsage: "info [opts] <path...>"},
-			{Name: "doctor", Exec: doDoctor, FlagSet: doctorFs, ShortHelp: "perform various checks (read-only)", ShortUsage: "doctor [opts] <path...>"},
-			{Name: "maintenance", Exec: doMaintenance, FlagSet: maintenanceFs, ShortHelp: "perform various maintenance tasks (write)", ShortUsage: "maintenance [opts] <path...>"},
+			{Name: "info", Exec: doInfo, FlagSet: infoFs, ShortHelp: "get project info", ShortUsage: "info [opts] [<path...>]"},
+			{Name: "doctor", Exec: doDoctor, FlagSet: doctorFs, ShortHelp: "perform various checks (read-only, unless -fix)", ShortUsage: "doctor [opts] [<path...>]"},
+			{Name: "status", Exec: doStatus, FlagSet: statusFs, ShortHelp: "print a table with the state of each project", ShortUsage: "status [opts] [<path...>]"},
+			{Name: "maintenance", Exec: doMaintenance, FlagSet: maintenanceFs, ShortHelp: "perform various maintenance tasks (write)", ShortUsage: "maintenance [opts] [<path...>]", LongHelp: maintenanceLongHelp()},
+			{Name: "exec", Exec: doExec, FlagSet: execFs, ShortHelp: "run a command in each project, and push the changes (write)", ShortUsage: "exec [opts] [<path...>] -- <command...>", LongHelp: execLongHelp},
+			{Name: "discover", Exec: doDiscover, FlagSet: discoverFs, ShortHelp: "list the git repositories found under directories", ShortUsage: "discover [opts] <dir...>"},
+			{Name: "clone", Exec: doClone, FlagSet: cloneFs, ShortHelp: "clone the missing repos of a GitHub organization or user, and fetch the existing ones", ShortUsage: "clone [opts] -owner <owner>"},
 			{Name: "version", Exec: doVersion, FlagSet: versionFs, ShortHelp: "show version and build info", ShortUsage: "version"},
-			{Name: "template-post-clone", Exec: doTemplatePostClone, FlagSet: templatePostCloneFs, ShortHelp: "replace template", ShortUsage: "template-post-clone [opts] <path...>"},
-			{Name: "assets-config", Exec: doAssetsConfig, FlagSet: assetsConfigFs, ShortHelp: "generate a configuration for assets", ShortUsage: "assets-config [opts] <path...>"},
+			{Name: "new", Exec: doNew, FlagSet: newFs, ShortHelp: "create a new project from a template", ShortUsage: "new [opts] <owner>/<name>"},
+			{Name: "template-post-clone", Exec: doTemplatePostClone, FlagSet: templatePostCloneFs, ShortHelp: "replace template", ShortUsage: "template-post-clone [opts] [<path...>]"},
+			{Name: "template-sync", Exec: doTemplateSync, FlagSet: templateSyncFs, ShortHelp: "merge the changes made to the template since the last sync (write)", ShortUsage: "template-sync [opts] [<path...>]"},
+			{Name: "assets-config", Exec: doAssetsConfig, FlagSet: assetsConfigFs, ShortHelp: "generate a configuration for assets", ShortUsage: "assets-config [opts] [<path...>]"},
 		},
 		Exec: func(ctx context.Context, args []string) error {
 			return flag.ErrHelp
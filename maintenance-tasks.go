@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"go.uber.org/zap"
+	"moul.io/u"
+)
+
+func renovateTask(_ context.Context, p *project) (TaskStatus, error) {
+	moved := renovateConfigMisplaced(p)
+	if err := moveRenovateConfig(p); err != nil {
+		return TaskFailed, err
+	}
+	status, err := copyTemplateFile(p, opts.Maintenance.TemplateDir, ".github/renovate.json")
+	if moved && err == nil {
+		status = TaskChanged
+	}
+	return status, err
+}
+
+func dependabotTask(_ context.Context, p *project) (TaskStatus, error) {
+	return copyTemplateFile(p, opts.Maintenance.TemplateDir, ".github/dependabot.yml")
+}
+
+func rulesMkTask(_ context.Context, p *project) (TaskStatus, error) {
+	if !u.FileExists(filepath.Join(p.Path, "rules.mk")) {
+		return TaskSkipped, nil
+	}
+	return copyTemplateFile(p, opts.Maintenance.RulesMkDir, "rules.mk")
+}
+
+func authorsTask(ctx context.Context, p *project) (TaskStatus, error) {
+	if !u.FileExists(filepath.Join(p.Path, "rules.mk")) || p.isExcluded("AUTHORS") {
+		return TaskSkipped, nil
+	}
+	status, err := filesChanged(p, []string{"AUTHORS"}, func() error {
+		return runCommand(ctx, p, "make", "generate.authors")
+	})
+	if err != nil || status != TaskChanged {
+		return status, err
+	}
+	if _, err := p.Git.workTree.Add(p.gitPath("AUTHORS")); err != nil {
+		return TaskFailed, fmt.Errorf("git add AUTHORS: %w", err)
+	}
+	return status, nil
+}
+
+// copyTemplateFile copies name from srcDir to the project and stages it.
+//
+// The task is skipped if srcDir does not contain the file, i.e., the template is not cloned locally,
+// or if the file is excluded by the manifest.
+func copyTemplateFile(p *project, srcDir string, name string) (TaskStatus, error) {
+	if p.isExcluded(name) {
+		return TaskSkipped, nil
+	}
+	srcDir, err := u.ExpandPath(srcDir)
+	if err != nil {
+		return TaskFailed, fmt.Errorf("expand path: %q: %w", srcDir, err)
+	}
+	src := filepath.Join(srcDir, name)
+	if !u.FileExists(src) {
+		logger.Warn("source file does not exist", zap.String("path", src))
+		return TaskSkipped, nil
+	}
+	content, err := ioutil.ReadFile(src)
+	if err != nil {
+		return TaskFailed, fmt.Errorf("read file: %q: %w", src, err)
+	}
+
+	dst := filepath.Join(p.Path, name)
+	if existing, err := ioutil.ReadFile(dst); err == nil && bytes.Equal(existing, content) {
+		return TaskUnchanged, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return TaskFailed, fmt.Errorf("mkdir %q: %w", filepath.Dir(dst), err)
+	}
+	if err := ioutil.WriteFile(dst, content, 0o644); err != nil { //nolint:gosec
+		return TaskFailed, fmt.Errorf("write file: %q: %w", dst, err)
+	}
+	if _, err := p.Git.workTree.Add(p.gitPath(name)); err != nil {
+		return TaskFailed, fmt.Errorf("git add %q: %w", name, err)
+	}
+	return TaskChanged, nil
+}
+
+// filesChanged runs fn and reports whether it changed the content of the given files.
+func filesChanged(p *project, names []string, fn func() error) (TaskStatus, error) {
+	read := func() []byte {
+		var all []byte
+		for _, name := range names {
+			content, _ := ioutil.ReadFile(filepath.Join(p.Path, name))
+			all = append(all, content...)
+			all = append(all, 0)
+		}
+		return all
+	}
+	before := read()
+	if err := fn(); err != nil {
+		return TaskFailed, err
+	}
+	if bytes.Equal(before, read()) {
+		return TaskUnchanged, nil
+	}
+	return TaskChanged, nil
+}
+
+// runCommand runs a command from the project's directory, its output is redirected to stderr.
+func runCommand(ctx context.Context, p *project, name string, args ...string) error {
+	return runCommandInDir(ctx, p.Path, name, args...)
+}
+
+func runCommandInDir(ctx context.Context, dir string, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("exec failed: %q: %w", cmd.String(), err)
+	}
+	return nil
+}
@@ -1,32 +1,111 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"flag"
 	"fmt"
 	"os"
-	"os/exec"
+	"strings"
+	"sync"
+	"text/tabwriter"
 
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
-	"moul.io/u"
 )
 
+// TaskStatus is the outcome of a MaintenanceTask.
+type TaskStatus string
+
+const (
+	TaskChanged   TaskStatus = "changed"
+	TaskUnchanged TaskStatus = "unchanged"
+	TaskSkipped   TaskStatus = "skipped" // prerequisites are missing, i.e., no rules.mk
+	TaskFailed    TaskStatus = "failed"
+)
+
+// MaintenanceTask is a single step of the maintenance subcommand.
+type MaintenanceTask struct {
+	ID          string
+	Description string
+	// Standard tasks are enabled by the -std flag, the other ones have their own flag.
+	Standard bool
+	Run      func(ctx context.Context, p *project) (TaskStatus, error)
+}
+
+// maintenanceTasks is the registry of the maintenance tasks, in execution order.
+var maintenanceTasks = []*MaintenanceTask{
+	{ID: "bump-deps", Description: "bump Go dependencies", Run: bumpDepsTask},
+	{ID: "renovate", Description: "move renovate.json to .github/ and sync it with the template", Standard: true, Run: renovateTask},
+	{ID: "dependabot", Description: "sync .github/dependabot.yml with the template", Standard: true, Run: dependabotTask},
+	{ID: "rules-mk", Description: "sync rules.mk with upstream", Standard: true, Run: rulesMkTask},
+	{ID: "authors", Description: "regenerate AUTHORS", Standard: true, Run: authorsTask},
+	{ID: "copyright", Description: "update copyright years", Standard: true, Run: copyrightTask},
+	{ID: "workflows", Description: "bump actions and tools in GitHub workflows", Standard: true, Run: workflowsTask},
+}
+
+// enabledMaintenanceTasks returns the tasks to run on a project.
+//
+// Tasks are selected by the -std and -bump-deps flags, then by the project's manifest,
+// and finally by -only and -skip which take precedence.
+func enabledMaintenanceTasks(p *project) []*MaintenanceTask {
+	only := splitList(opts.Maintenance.Only)
+	skip := splitList(opts.Maintenance.Skip)
+	standard := p.Manifest.taskEnabled("std", opts.Maintenance.Standard)
+
+	var ret []*MaintenanceTask
+	for _, task := range maintenanceTasks {
+		enabled := standard
+		if !task.Standard {
+			enabled = task.ID == "bump-deps" && opts.Maintenance.BumpDeps
+		}
+		enabled = p.Manifest.taskEnabled(task.ID, enabled)
+		if len(only) > 0 {
+			enabled = containsString(only, task.ID)
+		}
+		if containsString(skip, task.ID) {
+			enabled = false
+		}
+		if enabled {
+			ret = append(ret, task)
+		}
+	}
+	return ret
+}
+
+// checkMaintenanceTaskIDs rejects the unknown task IDs given to -only and -skip.
+func checkMaintenanceTaskIDs() error {
+	for _, id := range append(splitList(opts.Maintenance.Only), splitList(opts.Maintenance.Skip)...) {
+		if maintenanceTaskByID(id) == nil {
+			return fmt.Errorf("unknown maintenance task: %q", id) //nolint:goerr113
+		}
+	}
+	return nil
+}
+
 func doMaintenance(ctx context.Context, args []string) error {
-	if len(args) < 1 {
-		return flag.ErrHelp
+	if err := checkMaintenanceTaskIDs(); err != nil {
+		return err
+	}
+	paths, err := targetPaths(args)
+	if err != nil {
+		return err
 	}
-	paths := u.UniqueStrings(args)
 	g, ctx := errgroup.WithContext(ctx)
 	logger.Debug("doMaintenance", zap.Any("opts", opts), zap.Strings("projects", paths))
 
-	var errs error
-
+	var (
+		errs  error
+		mutex sync.Mutex
+	)
 	for _, path := range paths {
 		path := path
 		g.Go(func() error {
-			err := doMaintenanceOnce(ctx, path)
+			err := runWriteCommand(ctx, "maintenance", path, opts.Maintenance.Project, func(project *project) error {
+				return doMaintenanceOnce(ctx, project)
+			})
+			mutex.Lock()
+			defer mutex.Unlock()
 			if err != nil {
 				errs = multierr.Append(errs, fmt.Errorf("%q: %w", path, err))
 			}
@@ -37,12 +116,7 @@ func doMaintenance(ctx context.Context, args []string) error {
 	return errs
 }
 
-func doMaintenanceOnce(_ context.Context, path string) error {
-	project, err := projectFromPath(path)
-	if err != nil {
-		return fmt.Errorf("invalid project: %w", err)
-	}
-
+func doMaintenanceOnce(ctx context.Context, project *project) error {
 	// prepare workspace
 	{
 		err := project.prepareWorkspace(opts.Maintenance.Project)
@@ -51,94 +125,109 @@ func doMaintenanceOnce(_ context.Context, path string) error {
 		}
 	}
 
-	// TODO
-	// - repoman.yml ->
-	//   - template -> moul/golang-repo-template
-	//   - exclude: - README.md
-	//   - no-main / lib-only
-	// - auto update from template
-	// - open PR / update existing one
-
-	if opts.Maintenance.BumpDeps {
-		logger.Debug("bumping deps", zap.String("project", project.Path))
-		// TODO: for each dirs with a go.mod, except vendor; overridable by repoman.yml
-		// TODO: overridable go binary
-		cmd := exec.Command("go", "get", "-u", "./...")
-		cmd.Stdout = os.Stderr
-		cmd.Stderr = os.Stderr
-		cmd.Dir = project.Path
-		cmd.Env = os.Environ()
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("exec failed: %w", err)
+	// run tasks
+	var failed error
+	{
+		var report bytes.Buffer
+		fmt.Fprintf(&report, "%s:\n", project.Path)
+		w := tabwriter.NewWriter(&report, 0, 8, 2, ' ', 0)
+		for _, task := range enabledMaintenanceTasks(project) {
+			logger.Debug("run maintenance task", zap.String("task", task.ID), zap.String("project", project.Path))
+			status, err := project.runMaintenanceTask(ctx, task)
+			if err != nil {
+				status = TaskFailed
+				failed = multierr.Append(failed, fmt.Errorf("%s: %w", task.ID, err))
+				fmt.Fprintf(w, "  %s\t%s: %v\n", task.ID, status, err)
+				continue
+			}
+			fmt.Fprintf(w, "  %s\t%s\n", task.ID, status)
 		}
+		_ = w.Flush()
+		fmt.Fprint(os.Stderr, report.String())
 	}
 
-	if opts.Maintenance.Standard {
-		logger.Debug("applying standard changes", zap.String("project", project.Path))
-		script := `
-			main() {
-				# renovate.json
-				mkdir -p .github
-				git mv renovate.json .github/renovate.json || true
-				git rm -f renovate.json || true
-				cp ~/go/src/moul.io/golang-repo-template/.github/renovate.json .github/ || true
-				git add .github/renovate.json || true
-				git add renovate.json || true
-
-				# dependabot
-				cp ~/go/src/moul.io/golang-repo-template/.github/dependabot.yml .github/ || true
-				git add .github/dependabot.yml || true
-
-				# rules.mk
-				if [ -f rules.mk ]; then cp ~/go/src/moul.io/rules.mk/rules.mk .; fi || true
-
-				# authors
-				if [ -f rules.mk ]; then make generate.authors; git add AUTHORS; fi || true
-
-				# copyright
-				set -xe; \
-				for prefix in "©" "Copyright" "Copyright (c)"; do \
-					for file in README.md LICENSE-APACHE LICENSE-MIT LICENSE COPYRIGHT; do \
-						if [ -f "$file" ]; then \
-							sed -i "s/$prefix 2014 /$prefix 2014-2021 /" $file; \
-							sed -i "s/$prefix 2015 /$prefix 2015-2021 /" $file; \
-							sed -i "s/$prefix 2016 /$prefix 2016-2021 /" $file; \
-							sed -i "s/$prefix 2017 /$prefix 2017-2021 /" $file; \
-							sed -i "s/$prefix 2018 /$prefix 2018-2021 /" $file; \
-							sed -i "s/$prefix 2019 /$prefix 2019-2021 /" $file; \
-							sed -i "s/$prefix 2020 /$prefix 2020-2021 /" $file; \
-							sed -i "s/$prefix \([0-9][0-9][0-9][0-9]\)-20[0-9][0-9] /$prefix \1-2021 /" $file; \
-							sed -i "s/$prefix 2021-2021/$prefix 2021 /" $file; \
-						fi; \
-					done; \
-				done
-
-				# golangci-lint fix
-				sed -i "s/version: v1.26/version: v1.38/" .github/workflows/*.yml || true
-				sed -i "s/version: v1.27/version: v1.38/" .github/workflows/*.yml || true
-				sed -i "s/version: v1.28/version: v1.38/" .github/workflows/*.yml || true
-		       }
-		       main
-		`
-		cmd := exec.Command("/bin/sh", "-xec", script)
-		cmd.Stdout = os.Stderr
-		cmd.Stderr = os.Stderr
-		cmd.Dir = project.Path
-		cmd.Env = os.Environ()
-
-		err := cmd.Run()
+	// push changes, the ones of the tasks that succeeded are kept even if other tasks failed
+	{
+		_, err := project.pushChanges(ctx, opts.Maintenance.Project, "dev/moul/maintenance", "chore: repo maintenance 🤖")
 		if err != nil {
-			return fmt.Errorf("standard script execution failed: %w", err)
+			return multierr.Append(failed, fmt.Errorf("push changes: %w", err))
 		}
 	}
+	if failed != nil {
+		return &changesKeptError{fmt.Errorf("maintenance tasks failed: %w", failed)}
+	}
 
-	// push changes
-	{
-		err := project.pushChanges(opts.TemplatePostClone.Project, "dev/moul/maintenance", "chore: repo maintenance 🤖")
-		if err != nil {
-			return fmt.Errorf("push changes: %w", err)
+	return nil
+}
+
+// runMaintenanceTask runs a task, and reverts its changes if it fails, so that the changes of the previous tasks are kept.
+func (p *project) runMaintenanceTask(ctx context.Context, task *MaintenanceTask) (TaskStatus, error) {
+	previous, err := p.runPatch(ctx)
+	if err != nil {
+		return TaskFailed, err
+	}
+	status, runErr := task.Run(ctx, p)
+	if runErr == nil {
+		return status, nil
+	}
+	revert := func() error {
+		if err := runCommandInDir(ctx, p.Git.Root, "git", "reset", "-q", "--hard"); err != nil {
+			return err
+		}
+		if err := runCommandInDir(ctx, p.Git.Root, "git", "clean", "-q", "-f", "-d"); err != nil {
+			return err
+		}
+		if len(previous) == 0 {
+			return nil
+		}
+		return p.applyPatch(ctx, previous)
+	}
+	if err := revert(); err != nil {
+		return TaskFailed, multierr.Append(runErr, fmt.Errorf("revert: %w", err))
+	}
+	return TaskFailed, runErr
+}
+
+func maintenanceLongHelp() string {
+	var b strings.Builder
+	b.WriteString("TASKS\n")
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	for _, task := range maintenanceTasks {
+		group := "-bump-deps"
+		if task.Standard {
+			group = "-std"
 		}
+		fmt.Fprintf(w, "  %s\t%s (%s)\n", task.ID, task.Description, group)
 	}
+	_ = w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
 
+func maintenanceTaskByID(id string) *MaintenanceTask {
+	for _, task := range maintenanceTasks {
+		if task.ID == id {
+			return task
+		}
+	}
 	return nil
 }
+
+// splitList splits a comma-separated flag value, ignoring empty items.
+func splitList(s string) []string {
+	var ret []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
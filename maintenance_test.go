@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"moul.io/u"
+)
+
+func TestEnabledMaintenanceTasks(t *testing.T) {
+	saved := opts.Maintenance
+	defer func() { opts.Maintenance = saved }()
+
+	tests := []struct {
+		name     string
+		standard bool
+		bumpDeps bool
+		only     string
+		skip     string
+		manifest string // tasks section
+		expected string // comma-separated task IDs, or the error
+	}{
+		{name: "none", expected: ""},
+		{name: "std", standard: true, expected: "renovate,dependabot,rules-mk,authors,copyright,workflows"},
+		{name: "bump-deps", bumpDeps: true, expected: "bump-deps"},
+		{name: "std and bump-deps", standard: true, bumpDeps: true, expected: "bump-deps,renovate,dependabot,rules-mk,authors,copyright,workflows"},
+		{name: "only", only: "copyright, authors", expected: "authors,copyright"},
+		{name: "only overrides std", standard: true, only: "bump-deps", expected: "bump-deps"},
+		{name: "skip", standard: true, skip: "rules-mk,,workflows", expected: "renovate,dependabot,authors,copyright"},
+		{name: "skip wins over only", only: "authors,copyright", skip: "authors", expected: "copyright"},
+		{name: "unknown only", only: "authors,foo", expected: `unknown maintenance task: "foo"`},
+		{name: "unknown skip", skip: "bar", expected: `unknown maintenance task: "bar"`},
+		{name: "manifest enables std", manifest: "enable: [std]", expected: "renovate,dependabot,rules-mk,authors,copyright,workflows"},
+		{name: "manifest disables std", standard: true, manifest: "disable: [std]", expected: ""},
+		{name: "manifest enables a task", manifest: "enable: [bump-deps, authors]", expected: "bump-deps,authors"},
+		{name: "manifest disables a task", standard: true, manifest: "disable: [copyright, dependabot]", expected: "renovate,rules-mk,authors,workflows"},
+		{name: "only overrides the manifest", manifest: "disable: [authors]", only: "authors", expected: "authors"},
+		{name: "skip with the manifest", manifest: "enable: [std]", skip: "renovate,dependabot,rules-mk,authors", expected: "copyright,workflows"},
+	}
+	for _, tt := range tests {
+		opts.Maintenance.Standard = tt.standard
+		opts.Maintenance.BumpDeps = tt.bumpDeps
+		opts.Maintenance.Only = tt.only
+		opts.Maintenance.Skip = tt.skip
+
+		if err := checkMaintenanceTaskIDs(); err != nil {
+			if err.Error() != tt.expected {
+				t.Errorf("%s: expected %q, got error %v", tt.name, tt.expected, err)
+			}
+			continue
+		}
+
+		p := &project{}
+		if tt.manifest != "" {
+			dir := t.TempDir()
+			if err := ioutil.WriteFile(filepath.Join(dir, "repoman.yml"), []byte("tasks: {"+tt.manifest+"}\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			m, err := loadManifest(dir)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			p.Manifest = m
+		}
+		var ids []string
+		for _, task := range enabledMaintenanceTasks(p) {
+			ids = append(ids, task.ID)
+		}
+		if expected := splitList(tt.expected); !reflect.DeepEqual(ids, expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, expected, ids)
+		}
+	}
+}
+
+func TestDoMaintenanceFailedTask(t *testing.T) {
+	logger = zap.NewNop()
+	dir := newTestProject(t)
+	for _, name := range repomanRequiredFiles {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return string(out)
+	}
+	git("add", "-A")
+	git("commit", "-qm", "setup")
+
+	// write creates a file and stages it, like the real tasks
+	write := func(name string, err error) func(ctx context.Context, p *project) (TaskStatus, error) {
+		return func(ctx context.Context, p *project) (TaskStatus, error) {
+			if err := ioutil.WriteFile(filepath.Join(p.Path, name), []byte(name), 0o644); err != nil {
+				return TaskFailed, err
+			}
+			if _, err := p.Git.workTree.Add(p.gitPath(name)); err != nil {
+				return TaskFailed, err
+			}
+			if err := ioutil.WriteFile(filepath.Join(p.Path, "README.md"), []byte(name), 0o644); err != nil {
+				return TaskFailed, err
+			}
+			return TaskChanged, err
+		}
+	}
+	savedTasks, savedOpts := maintenanceTasks, opts.Maintenance
+	defer func() { maintenanceTasks, opts.Maintenance = savedTasks, savedOpts }()
+	maintenanceTasks = []*MaintenanceTask{
+		{ID: "a", Run: write("A", nil)},
+		{ID: "fail", Run: write("FAIL", errors.New("boom"))},
+		{ID: "b", Run: write("B", nil)},
+	}
+	opts.Maintenance.Only = "a,fail,b"
+	opts.Maintenance.Project = projectOpts{OnFailure: onFailureRollback}
+
+	err := doMaintenance(context.Background(), []string{dir})
+	if err == nil || !strings.Contains(err.Error(), "fail: boom") {
+		t.Fatalf("expected the failed task to be reported, got %v", err)
+	}
+	if !u.FileExists(filepath.Join(dir, "A")) || !u.FileExists(filepath.Join(dir, "B")) {
+		t.Errorf("expected the changes of the tasks that succeeded to be kept")
+	}
+	if u.FileExists(filepath.Join(dir, "FAIL")) {
+		t.Errorf("expected the changes of the failed task to be reverted")
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "README.md")); string(content) != "B" {
+		t.Errorf("expected README.md to be changed by the last task, got %q", content)
+	}
+	if status := git("status", "--porcelain", "--untracked-files=all"); strings.Contains(status, "FAIL") {
+		t.Errorf("unexpected status:\n%s", status)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+	"moul.io/u"
+)
+
+// manifestFilenames contains the supported locations of the per-repository manifest, by order of priority.
+var manifestFilenames = []string{"repoman.yml", ".repoman.yml", ".github/repoman.yml"}
+
+const (
+	metadataGuessed      = "guessed"
+	metadataFromManifest = "manifest"
+)
+
+// manifest is the content of an optional repoman.yml file stored in a project.
+//
+// It is used to override the metadata guessed by repoman and to opt tasks in or out.
+type manifest struct {
+	// Template is the template the project was generated from, i.e., "moul/golang-repo-template".
+	Template string `yaml:"template,omitempty" json:"Template,omitempty"`
+	// TemplateCommit is the commit of the template the project was generated from, or last synced with.
+	TemplateCommit string `yaml:"template-commit,omitempty" json:"TemplateCommit,omitempty"`
+	// TemplateVars are the values of the variables and features declared by the template's manifest.
+	TemplateVars map[string]string `yaml:"template-vars,omitempty" json:"TemplateVars,omitempty"`
+	// Forge overrides the kind of forge guessed from the clone URL, useful for self-hosted instances.
+	Forge forgeKind `yaml:"forge,omitempty" json:"Forge,omitempty"`
+	// Exclude lists files that should never be modified by repoman, globs are supported.
+	Exclude []string `yaml:"exclude,omitempty" json:"Exclude,omitempty"`
+	// LibOnly is a shortcut for "has-binary: false, has-docker: false, has-library: true".
+	LibOnly *bool `yaml:"lib-only,omitempty" json:"LibOnly,omitempty"`
+	// Metadata overrides the guessed metadata, unset fields are still guessed.
+	Metadata struct {
+		HasGo      *bool  `yaml:"has-go,omitempty" json:"HasGo,omitempty"`
+		HasDocker  *bool  `yaml:"has-docker,omitempty" json:"HasDocker,omitempty"`
+		HasLibrary *bool  `yaml:"has-library,omitempty" json:"HasLibrary,omitempty"`
+		HasBinary  *bool  `yaml:"has-binary,omitempty" json:"HasBinary,omitempty"`
+		GoModPath  string `yaml:"go-mod-path,omitempty" json:"GoModPath,omitempty"`
+	} `yaml:"metadata,omitempty" json:"Metadata,omitempty"`
+	// Tasks enables or disables tasks regardless of the command-line flags.
+	Tasks struct {
+		Enable  []string `yaml:"enable,omitempty" json:"Enable,omitempty"`
+		Disable []string `yaml:"disable,omitempty" json:"Disable,omitempty"`
+	} `yaml:"tasks,omitempty" json:"Tasks,omitempty"`
+	// BumpDeps configures the bump-deps maintenance task.
+	BumpDeps struct {
+		// Include and Exclude filter the module directories, relative to the project's root, globs are supported.
+		Include []string `yaml:"include,omitempty" json:"Include,omitempty"`
+		Exclude []string `yaml:"exclude,omitempty" json:"Exclude,omitempty"`
+		// GoBin is the go binary used to update the modules, i.e., "go1.21.0".
+		GoBin string `yaml:"go-bin,omitempty" json:"GoBin,omitempty"`
+	} `yaml:"bump-deps,omitempty" json:"BumpDeps,omitempty"`
+	// Workflows overrides the minimal versions of the actions and tools used in GitHub workflows.
+	Workflows workflowTargets `yaml:"workflows,omitempty" json:"Workflows,omitempty"`
+
+	// Path is the path of the file the manifest was loaded from.
+	Path string `yaml:"-" json:"Path,omitempty"`
+}
+
+// loadManifest looks for a manifest file in dir, it returns nil if the project does not have one.
+func loadManifest(dir string) (*manifest, error) {
+	for _, filename := range manifestFilenames {
+		path := filepath.Join(dir, filename)
+		if !u.FileExists(path) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read manifest: %q: %w", path, err)
+		}
+
+		var ret manifest
+		dec := yaml.NewDecoder(bytes.NewReader(content))
+		dec.KnownFields(true)
+		if err := dec.Decode(&ret); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parse manifest: %q: %w", path, err)
+		}
+		ret.Path = path
+		return &ret, nil
+	}
+	return nil, nil
+}
+
+// applyMetadata overrides the project's guessed metadata with the ones defined in the manifest.
+//
+// HasLibrary is computed again from the final HasGo and HasBinary values, unless it is explicitly set.
+func (m *manifest) applyMetadata(p *project) {
+	metadata := &p.Git.Metadata
+	if metadata.Sources == nil {
+		metadata.Sources = make(map[string]string)
+	}
+	override := func(field string, dst **bool, val *bool) {
+		if val != nil {
+			*dst = u.BoolPtr(*val)
+			metadata.Sources[field] = metadataFromManifest
+		}
+	}
+
+	libOnly := m.LibOnly != nil && *m.LibOnly
+	if libOnly {
+		override("HasBinary", &metadata.HasBinary, u.BoolPtr(false))
+		override("HasDocker", &metadata.HasDocker, u.BoolPtr(false))
+	}
+	override("HasGo", &metadata.HasGo, m.Metadata.HasGo)
+	override("HasDocker", &metadata.HasDocker, m.Metadata.HasDocker)
+	override("HasBinary", &metadata.HasBinary, m.Metadata.HasBinary)
+	override("HasLibrary", &metadata.HasLibrary, m.Metadata.HasLibrary)
+	if libOnly && m.Metadata.HasLibrary == nil && *metadata.HasGo { // a project without Go has no library
+		override("HasLibrary", &metadata.HasLibrary, u.BoolPtr(true))
+	}
+	if m.Metadata.GoModPath != "" {
+		metadata.GoModPath = m.Metadata.GoModPath
+		metadata.Sources["GoModPath"] = metadataFromManifest
+	}
+
+	if metadata.Sources["HasLibrary"] != metadataFromManifest {
+		metadata.HasLibrary = u.BoolPtr(*metadata.HasGo && !*metadata.HasBinary)
+	}
+}
+
+// taskEnabled returns whether the task should run, def is the value configured with the command-line flags.
+//
+// It is safe to call it on a nil manifest.
+func (m *manifest) taskEnabled(name string, def bool) bool {
+	if m == nil {
+		return def
+	}
+	for _, task := range m.Tasks.Disable {
+		if task == name {
+			return false
+		}
+	}
+	for _, task := range m.Tasks.Enable {
+		if task == name {
+			return true
+		}
+	}
+	return def
+}
+
+// isExcluded returns whether a path, relative to the project, is in the manifest's exclude list.
+//
+// Every command writing to the project's files checks it.
+func (p *project) isExcluded(rel string) bool {
+	return p.Manifest != nil && matchAnyGlob(p.Manifest.Exclude, filepath.ToSlash(rel))
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"moul.io/u"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".github"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := loadManifest(dir); m != nil || err != nil {
+		t.Fatalf("expected no manifest, got %v %v", m, err)
+	}
+
+	// the locations are looked up by order of priority, from the last to the first
+	for i := len(manifestFilenames) - 1; i >= 0; i-- {
+		filename := manifestFilenames[i]
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), []byte("forge: "+filename+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m, err := loadManifest(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", filename, err)
+		}
+		if string(m.Forge) != filename || m.Path != filepath.Join(dir, filename) {
+			t.Errorf("expected %s to be loaded, got %q from %q", filename, m.Forge, m.Path)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "repoman.yml"), []byte("unknown: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadManifest(dir); err == nil {
+		t.Errorf("expected an error for an unknown field")
+	}
+}
+
+func TestApplyMetadata(t *testing.T) {
+	type metadata struct{ hasGo, hasBinary, hasDocker, hasLibrary bool }
+	tests := []struct {
+		name     string
+		manifest string
+		guessed  metadata
+		expected metadata
+		sources  map[string]string
+	}{
+		{
+			name:     "guessed",
+			guessed:  metadata{hasGo: true, hasDocker: true},
+			expected: metadata{hasGo: true, hasDocker: true, hasLibrary: true},
+			sources:  map[string]string{},
+		},
+		{
+			name:     "override",
+			manifest: "metadata: {has-binary: true}",
+			guessed:  metadata{hasGo: true},
+			expected: metadata{hasGo: true, hasBinary: true},
+			sources:  map[string]string{"HasBinary": metadataFromManifest},
+		},
+		{
+			name:     "lib-only",
+			manifest: "lib-only: true",
+			guessed:  metadata{hasGo: true, hasBinary: true, hasDocker: true},
+			expected: metadata{hasGo: true, hasLibrary: true},
+			sources:  map[string]string{"HasBinary": metadataFromManifest, "HasDocker": metadataFromManifest, "HasLibrary": metadataFromManifest},
+		},
+		{
+			name:     "lib-only without Go",
+			manifest: "lib-only: true",
+			guessed:  metadata{hasDocker: true},
+			expected: metadata{},
+			sources:  map[string]string{"HasBinary": metadataFromManifest, "HasDocker": metadataFromManifest},
+		},
+		{
+			name:     "lib-only with has-go: false",
+			manifest: "lib-only: true\nmetadata: {has-go: false}",
+			guessed:  metadata{hasGo: true},
+			expected: metadata{},
+			sources:  map[string]string{"HasBinary": metadataFromManifest, "HasDocker": metadataFromManifest, "HasGo": metadataFromManifest},
+		},
+		{
+			name:     "explicit has-library",
+			manifest: "metadata: {has-library: false}",
+			guessed:  metadata{hasGo: true},
+			expected: metadata{hasGo: true},
+			sources:  map[string]string{"HasLibrary": metadataFromManifest},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(dir, "repoman.yml"), []byte(tt.manifest), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m, err := loadManifest(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		p := &project{}
+		p.Git.Metadata.HasGo = u.BoolPtr(tt.guessed.hasGo)
+		p.Git.Metadata.HasBinary = u.BoolPtr(tt.guessed.hasBinary)
+		p.Git.Metadata.HasDocker = u.BoolPtr(tt.guessed.hasDocker)
+		m.applyMetadata(p)
+
+		got := metadata{*p.Git.Metadata.HasGo, *p.Git.Metadata.HasBinary, *p.Git.Metadata.HasDocker, *p.Git.Metadata.HasLibrary}
+		if got != tt.expected {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expected, got)
+		}
+		if len(p.Git.Metadata.Sources) != len(tt.sources) {
+			t.Errorf("%s: expected sources %v, got %v", tt.name, tt.sources, p.Git.Metadata.Sources)
+		}
+		for field, source := range tt.sources {
+			if p.Git.Metadata.Sources[field] != source {
+				t.Errorf("%s: expected sources %v, got %v", tt.name, tt.sources, p.Git.Metadata.Sources)
+			}
+		}
+	}
+}
+
+func TestTaskEnabled(t *testing.T) {
+	m := &manifest{}
+	m.Tasks.Enable = []string{"bump-deps", "authors"}
+	m.Tasks.Disable = []string{"authors", "copyright"}
+
+	tests := []struct {
+		manifest *manifest
+		task     string
+		def      bool
+		expected bool
+	}{
+		{nil, "copyright", true, true},
+		{nil, "copyright", false, false},
+		{m, "bump-deps", false, true},
+		{m, "copyright", true, false},
+		{m, "authors", true, false}, // disable wins
+		{m, "renovate", true, true},
+		{m, "renovate", false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.manifest.taskEnabled(tt.task, tt.def); got != tt.expected {
+			t.Errorf("%s (default %v): expected %v, got %v", tt.task, tt.def, tt.expected, got)
+		}
+	}
+}
+
+func TestManifestExclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"repoman.yml": "exclude: [README.md, 'internal/*.go', .github/dependabot.yml]\n",
+		"README.md":   "Copyright 2019 Foo\n",
+		"LICENSE":     "Copyright 2019 Foo\n",
+		"main.go":     "// Copyright 2019 Foo\n\npackage main\n",
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "internal"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files["internal/foo.go"] = files["main.go"]
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &project{Path: dir, Manifest: m}
+
+	for name, expected := range map[string]bool{"README.md": true, "internal/foo.go": true, "main.go": false, "docs/README.md": false} {
+		if got := p.isExcluded(name); got != expected {
+			t.Errorf("%s: expected excluded=%v, got %v", name, expected, got)
+		}
+	}
+	if (&project{}).isExcluded("README.md") {
+		t.Errorf("nothing is excluded without manifest")
+	}
+
+	// the writers skip the excluded files
+	stale, err := updateCopyrightFiles(p, 2026, true)
+	if err != nil {
+		t.Fatalf("copyright: %v", err)
+	}
+	if !reflect.DeepEqual(stale, []string{"LICENSE", "main.go"}) {
+		t.Errorf("expected only the files not excluded to be updated, got %v", stale)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "README.md")); string(content) != files["README.md"] {
+		t.Errorf("expected README.md to be untouched, got %q", content)
+	}
+	if status, err := copyTemplateFile(p, dir, ".github/dependabot.yml"); status != TaskSkipped || err != nil {
+		t.Errorf("expected the excluded file not to be copied, got %s %v", status, err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"go.uber.org/zap"
+	"moul.io/u"
+)
+
+func doNew(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return flag.ErrHelp
+	}
+	parts := strings.Split(args[0], "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid project name %q, expected <owner>/<name>", args[0]) //nolint:goerr113
+	}
+	owner, name := parts[0], parts[1]
+	dir := opts.New.Dir
+	if dir == "" {
+		dir = name
+	}
+	origin := opts.New.Origin
+	if origin == "" {
+		origin = fmt.Sprintf("git@github.com:%s/%s.git", owner, name)
+	}
+	logger.Debug("doNew", zap.Any("opts", opts), zap.String("dir", dir), zap.String("origin", origin))
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		return fmt.Errorf("destination already exists: %q", dir) //nolint:goerr113
+	}
+	if err := newProject(ctx, dir, origin); err != nil {
+		if rmErr := os.RemoveAll(dir); rmErr != nil {
+			logger.Warn("failed to remove the partially created project", zap.String("dir", dir), zap.Error(rmErr))
+		}
+		return err
+	}
+	return nil
+}
+
+// newProject creates a project in dir from the template's HEAD, and commits it.
+func newProject(ctx context.Context, dir, origin string) error {
+	// export the template, without its history
+	template, err := openTemplate(ctx, opts.New.Source)
+	if err != nil {
+		return err
+	}
+	templateCommit, err := resolveCommit(template, "HEAD")
+	if err != nil {
+		return fmt.Errorf("resolve template HEAD: %w", err)
+	}
+	if err := exportCommit(templateCommit, dir); err != nil {
+		return fmt.Errorf("export template: %w", err)
+	}
+
+	// init the repo
+	{
+		repo, err := git.PlainInit(dir, false)
+		if err != nil {
+			return fmt.Errorf("git init: %w", err)
+		}
+		head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("main"))
+		if err := repo.Storer.SetReference(head); err != nil {
+			return fmt.Errorf("set HEAD: %w", err)
+		}
+		if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{origin}}); err != nil {
+			return fmt.Errorf("git remote add origin: %w", err)
+		}
+	}
+
+	project, err := projectFromPath(dir)
+	if err != nil {
+		return fmt.Errorf("invalid project: %w", err)
+	}
+	if _, err := project.Git.workTree.Add("."); err != nil {
+		return fmt.Errorf("git add: %w", err)
+	}
+
+	// post-clone
+	{
+		source := opts.New.Source
+		if path, err := u.ExpandPath(source); err == nil && u.DirExists(path) { // do not record local paths
+			source = opts.New.Template.TemplateOwner + "/" + opts.New.Template.TemplateName
+		}
+		if err := project.applyTemplate(ctx, opts.New.Template, source, templateCommit.Hash.String()); err != nil {
+			return err
+		}
+	}
+
+	// initial commit
+	{
+		if _, err := project.Git.workTree.Add("."); err != nil {
+			return fmt.Errorf("git add: %w", err)
+		}
+		hash, err := project.Git.workTree.Commit("chore: initial commit 🤖", &git.CommitOptions{Author: gitSignature(project.Git.repo)})
+		if err != nil {
+			return fmt.Errorf("git commit: %w", err)
+		}
+		logger.Info("project created", zap.String("path", project.Path), zap.String("origin", origin), zap.String("commit", hash.String()))
+	}
+	return nil
+}
+
+// exportCommit writes the files of a commit in dir, like "git archive".
+func exportCommit(commit *object.Commit, dir string) error {
+	files, err := commit.Files()
+	if err != nil {
+		return fmt.Errorf("list files: %w", err)
+	}
+	return files.ForEach(func(file *object.File) error {
+		path := filepath.Join(dir, filepath.FromSlash(file.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("mkdir %q: %w", filepath.Dir(path), err)
+		}
+		if file.Mode == filemode.Symlink {
+			target, err := file.Contents()
+			if err != nil {
+				return fmt.Errorf("read file: %q: %w", file.Name, err)
+			}
+			return os.Symlink(target, path)
+		}
+
+		mode, err := file.Mode.ToOSFileMode()
+		if err != nil {
+			return fmt.Errorf("file mode: %q: %w", file.Name, err)
+		}
+		reader, err := file.Reader()
+		if err != nil {
+			return fmt.Errorf("read file: %q: %w", file.Name, err)
+		}
+		defer reader.Close()
+		dst, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+		if err != nil {
+			return fmt.Errorf("create file: %q: %w", file.Name, err)
+		}
+		defer dst.Close()
+		if _, err := io.Copy(dst, reader); err != nil {
+			return fmt.Errorf("write file: %q: %w", file.Name, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"go.uber.org/zap"
+)
+
+// newTestTemplate creates a template repository with a Go module, an executable and a symlink.
+func newTestTemplate(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"README.md":      "# golang-repo-template\n\n`go get moul.io/golang-repo-template`\n",
+		"go.mod":         "module moul.io/golang-repo-template\n\ngo 1.16\n",
+		"main.go":        "package main\n\nfunc main() {}\n",
+		"Makefile":       "GOPKG ?= moul.io/golang-repo-template\n",
+		"rules.mk":       "",
+		"tool/script.sh": "#!/bin/sh\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(dir, "tool", "script.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("README.md", filepath.Join(dir, "README")); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"init", "-q", "-b", "master"}, {"add", "-A"}, {"commit", "-qm", "initial"}} {
+		out, err := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestExportCommit(t *testing.T) {
+	template, err := git.PlainOpen(newTestTemplate(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := resolveCommit(template, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "export")
+	if err := exportCommit(commit, dir); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "go.mod")); string(content) != "module moul.io/golang-repo-template\n\ngo 1.16\n" {
+		t.Errorf("unexpected go.mod: %q", content)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "tool", "script.sh")); err != nil || info.Mode()&0o100 == 0 {
+		t.Errorf("expected tool/script.sh to be executable: %v %v", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "README")); err != nil || target != "README.md" {
+		t.Errorf("expected README to link to README.md, got %q %v", target, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); !os.IsNotExist(err) {
+		t.Errorf("expected the history not to be exported: %v", err)
+	}
+}
+
+func TestDoNew(t *testing.T) {
+	logger = zap.NewNop()
+	for _, key := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(key+"_NAME", "t")
+		t.Setenv(key+"_EMAIL", "t@t")
+	}
+	saved := opts.New
+	defer func() { opts.New = saved }()
+	source := newTestTemplate(t)
+	ctx := context.Background()
+	setup := func(dir string) {
+		opts.New.Source = source
+		opts.New.Dir = dir
+		opts.New.Origin = ""
+		opts.New.Template = templateOpts{
+			TemplateName:  "golang-repo-template",
+			TemplateOwner: "moul",
+			NoFeatures:    map[string]*bool{},
+			ModulePath:    "moul.io/{name}",
+			MaxFileSize:   1 << 20,
+		}
+	}
+
+	dir := filepath.Join(t.TempDir(), "foo")
+	setup(dir)
+	yes := true
+	opts.New.Template.NoFeatures["docker"] = &yes
+	if err := doNew(ctx, []string{"bob/foo"}); err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	expected := map[string]string{
+		"README.md": "# foo\n\n`go get moul.io/foo`\n",
+		"go.mod":    "module moul.io/foo\n\ngo 1.16\n",
+	}
+	for name, content := range expected {
+		if got, _ := ioutil.ReadFile(filepath.Join(dir, name)); string(got) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+	if manifest, _ := ioutil.ReadFile(filepath.Join(dir, "repoman.yml")); !strings.Contains(string(manifest), "template: moul/golang-repo-template") {
+		t.Errorf("expected the template to be recorded, got:\n%s", manifest)
+	}
+	if m, err := loadManifest(dir); err != nil || m.TemplateVars["docker"] != "false" {
+		t.Errorf("expected the docker feature to be recorded as turned off: %v", err)
+	}
+	p, err := projectFromPath(dir)
+	if err != nil {
+		t.Fatalf("project: %v", err)
+	}
+	if p.Git.CurrentBranch != "main" || len(p.Git.OriginRemotes) != 1 || p.Git.OriginRemotes[0] != "git@github.com:bob/foo.git" {
+		t.Errorf("unexpected repo: branch %q, origin %v", p.Git.CurrentBranch, p.Git.OriginRemotes)
+	}
+	if err := p.updateStatus(); err != nil || *p.Git.IsDirty {
+		t.Errorf("expected everything to be committed: %v", err)
+	}
+
+	// the destination is never overwritten
+	if err := doNew(ctx, []string{"bob/foo"}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an error, got %v", err)
+	}
+
+	// on failure, the partially created project is removed
+	dir = filepath.Join(t.TempDir(), "bar")
+	setup(dir)
+	opts.New.Template.Set = stringSliceFlag{"unknown=true"}
+	if err := doNew(ctx, []string{"bob/bar"}); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected %q to be removed: %v", dir, err)
+	}
+}
@@ -1,25 +1,32 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"golang.org/x/mod/modfile"
-	"moul.io/multipmuri"
 	"moul.io/u"
 )
 
 type project struct {
-	Path string
-	Git  struct {
+	Path     string
+	Manifest *manifest `json:"Manifest,omitempty"`
+	Git      struct {
 		Root          string
 		MainBranch    string
 		CurrentBranch string
@@ -27,6 +34,8 @@ type project struct {
 		InMainBranch  bool
 		IsDirty       *bool
 		CloneURL      string
+		Forge         forgeKind
+		Host          string `json:"Host,omitempty"`
 		HTMLURL       string
 		RepoName      string
 		RepoOwner     string
@@ -36,6 +45,9 @@ type project struct {
 			HasLibrary *bool  `json:"HasLibrary,omitempty"`
 			HasBinary  *bool  `json:"HasBinary,omitempty"`
 			GoModPath  string `json:"GoModPath,omitempty"`
+
+			// Sources tells where each value comes from, either guessed or from the manifest.
+			Sources map[string]string `json:"Sources,omitempty"`
 		} `json:"Metadata,omitempty"`
 
 		head     *plumbing.Reference
@@ -44,6 +56,8 @@ type project struct {
 		workTree *git.Worktree
 		status   git.Status
 	}
+
+	notes []string // appended to the body of the pull-request
 }
 
 //nolint:nestif,gocognit
@@ -70,14 +84,33 @@ func projectFromPath(path string) (*project, error) {
 			project.Git.repo = repo
 		}
 
+		// manifest
+		{
+			manifest, err := loadManifest(project.Path)
+			if err != nil {
+				return nil, fmt.Errorf("load manifest: %w", err)
+			}
+			project.Manifest = manifest
+		}
+
 		// current branch
+		unborn := false
 		{
 			head, err := project.Git.repo.Head()
-			if err != nil {
+			switch {
+			case errors.Is(err, plumbing.ErrReferenceNotFound): // new repository without commits
+				ref, err := project.Git.repo.Storer.Reference(plumbing.HEAD)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get HEAD: %w", err)
+				}
+				unborn = true
+				project.Git.CurrentBranch = ref.Target().Short()
+			case err != nil:
 				return nil, fmt.Errorf("failed to get HEAD: %w", err)
+			default:
+				project.Git.head = head
+				project.Git.CurrentBranch = project.Git.head.Name().Short()
 			}
-			project.Git.head = head
-			project.Git.CurrentBranch = project.Git.head.Name().Short()
 		}
 
 		// 'origin' remote
@@ -89,19 +122,21 @@ func projectFromPath(path string) (*project, error) {
 			project.Git.origin = origin
 			project.Git.OriginRemotes = origin.Config().URLs
 			project.Git.CloneURL = origin.Config().URLs[0]
-			ret, err := multipmuri.DecodeString(project.Git.CloneURL)
+			var hint forgeKind
+			if project.Manifest != nil {
+				hint = project.Manifest.Forge
+			}
+			repo, err := parseForgeRepo(project.Git.CloneURL, hint)
 			if err != nil {
 				return nil, fmt.Errorf("failed to parse the clone URL: %w", err)
 			}
-			repo := multipmuri.RepoEntity(ret)
-			if typed, ok := repo.(*multipmuri.GitHubRepo); ok {
-				project.Git.RepoName = typed.RepoID()
-				project.Git.RepoOwner = typed.OwnerID()
-				project.Git.HTMLURL = typed.String()
-			} else {
-				// FIXME: guess name
-				// FIXME: guess owner
-				panic("not implemented")
+			project.Git.Forge = repo.Kind
+			project.Git.Host = repo.Host
+			project.Git.RepoName = repo.Name
+			project.Git.RepoOwner = repo.Owner
+			project.Git.HTMLURL = repo.HTMLURL
+			if err := project.applyWorkspaceOverrides(); err != nil {
+				return nil, err
 			}
 		}
 
@@ -109,9 +144,12 @@ func projectFromPath(path string) (*project, error) {
 		{
 			logger.Debug("rep.Reference(refs/remotes/origin/HEAD)")
 			ref, err := project.Git.repo.Reference("refs/remotes/origin/HEAD", true)
-			if err == nil {
+			switch {
+			case unborn: // the first branch of a new repository is the main one
+				project.Git.MainBranch = project.Git.CurrentBranch
+			case err == nil:
 				project.Git.MainBranch = strings.TrimPrefix(ref.Name().Short(), "origin/")
-			} else { // if it fails, we try to fetch origin and then we retry
+			default: // if it fails, we try to fetch origin and then we retry
 				logger.Debug("origin.List()")
 				refs, err := project.Git.origin.List(&git.ListOptions{})
 				if err != nil {
@@ -168,9 +206,21 @@ func projectFromPath(path string) (*project, error) {
 				project.Git.Metadata.HasGo = u.BoolPtr(len(goFiles) > 0)
 			}
 			project.Git.Metadata.HasLibrary = u.BoolPtr(*project.Git.Metadata.HasGo && !*project.Git.Metadata.HasBinary)
+			project.Git.Metadata.Sources = map[string]string{
+				"HasGo":      metadataGuessed,
+				"HasDocker":  metadataGuessed,
+				"HasLibrary": metadataGuessed,
+				"HasBinary":  metadataGuessed,
+			}
+			if project.Git.Metadata.GoModPath != "" {
+				project.Git.Metadata.Sources["GoModPath"] = metadataGuessed
+			}
 
 			// override it from metadata file
-			// FIXME: TODO
+			if project.Manifest != nil {
+				logger.Debug("override metadata from manifest", zap.String("path", project.Manifest.Path))
+				project.Manifest.applyMetadata(project)
+			}
 		}
 	} else {
 		logger.Warn("project not within a git directory", zap.String("path", path))
@@ -179,6 +229,18 @@ func projectFromPath(path string) (*project, error) {
 	return project, nil
 }
 
+// gitPath converts a path relative to the project into a path relative to the git root, as expected by the worktree.
+func (p *project) gitPath(name string) string {
+	rel, err := filepath.Rel(p.Git.Root, filepath.Join(p.Path, name))
+	if err != nil {
+		return name
+	}
+	return filepath.ToSlash(rel)
+}
+
+// repomanRequiredFiles are the files a project needs to be maintained by repoman.
+var repomanRequiredFiles = []string{"Makefile", "rules.mk"}
+
 func gitFindRootDir(path string) string {
 	for {
 		if u.DirExists(filepath.Join(path, ".git")) {
@@ -278,7 +340,7 @@ func (p *project) prepareWorkspace(opts projectOpts) error {
 	// check if the project looks like a one that can be maintained by repoman
 	{
 		var errs error
-		for _, expected := range []string{"Makefile", "rules.mk"} {
+		for _, expected := range repomanRequiredFiles {
 			if !u.FileExists(filepath.Join(p.Path, expected)) {
 				errs = multierr.Append(errs, fmt.Errorf("missing file: %q", expected))
 			}
@@ -314,50 +376,93 @@ func (p *project) showDiff() error {
 	return nil
 }
 
-func (p *project) openPR(branchName string, title string) error {
-	logger.Debug("opening a PR", zap.String("branch", branchName), zap.String("title", title))
-	initMoulBotEnv()
-	script := `
-		main() {
-			# apply changes
-			git branch -D {{.branchName}} || true
-			git checkout -b {{.branchName}}
-			git commit -s -a -m {{.title}} -m {{.body}}
-			git push -u origin {{.branchName}} -f
-			hub pull-request -m {{.title}} -m {{.body}} || hub pr list -f "- %pC%>(8)%i%Creset %U - %t% l%n"
-		}
-		main
-	`
-	body := "more details: https://github.com/moul/repoman"
-	script = strings.ReplaceAll(script, "{{.branchName}}", fmt.Sprintf("%q", branchName))
-	script = strings.ReplaceAll(script, "{{.title}}", fmt.Sprintf("%q", title))
-	script = strings.ReplaceAll(script, "{{.body}}", fmt.Sprintf("%q", body))
-	cmd := exec.Command("/bin/sh", "-xec", script)
-	cmd.Stdout = os.Stderr
-	cmd.Stderr = os.Stderr
-	cmd.Dir = p.Path
-	cmd.Env = os.Environ()
+// gitAuth returns the credentials used to push over HTTPS, SSH remotes rely on the SSH agent.
+func (p *project) gitAuth() transport.AuthMethod {
+	return gitAuthForURL(p.Git.CloneURL)
+}
 
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("publish script execution failed: %w", err)
+// gitAuthForURL returns the credentials used for an HTTPS remote, from $GITHUB_TOKEN.
+func gitAuthForURL(remoteURL string) transport.AuthMethod {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" || !strings.HasPrefix(remoteURL, "http") {
+		return nil
 	}
-	return nil
+	return &githttp.BasicAuth{Username: "x-access-token", Password: token}
+}
+
+// gitSignature returns the identity used to commit, configured with the standard $GIT_AUTHOR_* variables,
+// or else with user.name and user.email of the repo's git config, or of the global one if repo is nil.
+func gitSignature(repo *git.Repository) *object.Signature {
+	signature := &object.Signature{
+		Name:  os.Getenv("GIT_AUTHOR_NAME"),
+		Email: os.Getenv("GIT_AUTHOR_EMAIL"),
+		When:  time.Now(),
+	}
+	if signature.Name == "" || signature.Email == "" {
+		var (
+			cfg *config.Config
+			err error
+		)
+		if repo != nil {
+			cfg, err = repo.ConfigScoped(config.GlobalScope) // the local config, merged with the global one
+		} else {
+			cfg, err = config.LoadConfig(config.GlobalScope)
+		}
+		if err != nil {
+			logger.Debug("cannot read git config", zap.Error(err))
+		} else {
+			if signature.Name == "" {
+				signature.Name = cfg.User.Name
+			}
+			if signature.Email == "" {
+				signature.Email = cfg.User.Email
+			}
+		}
+	}
+	if signature.Name == "" {
+		signature.Name = "repoman"
+	}
+	if signature.Email == "" {
+		signature.Email = "repoman@localhost"
+	}
+	return signature
 }
 
-func (p *project) pushChanges(opts projectOpts, branchName string, prTitle string) error {
+func (p *project) pushChanges(ctx context.Context, opts projectOpts, branchName string, prTitle string) (*pullRequest, error) {
+	if opts.DryRun { // the changes are reported as a patch by runWriteCommand
+		return nil, nil
+	}
 	if opts.ShowDiff {
 		err := p.showDiff()
 		if err != nil {
-			return fmt.Errorf("show diff: %w", err)
+			return nil, fmt.Errorf("show diff: %w", err)
 		}
 	}
 
 	if opts.OpenPR {
-		err := p.openPR(branchName, prTitle)
+		pr, err := p.openPR(ctx, opts, branchName, prTitle)
 		if err != nil {
-			return fmt.Errorf("open PR: %w", err)
+			return nil, fmt.Errorf("open PR: %w", err)
+		}
+		if pr == nil {
+			logger.Info("nothing to push", zap.String("project", p.Path))
+			return nil, nil
 		}
+		if p.Git.Forge != forgeGitHub {
+			logger.Warn("pull-requests are not supported on this forge, open it manually",
+				zap.String("project", p.Path),
+				zap.String("forge", string(p.Git.Forge)),
+				zap.String("branch", branchName),
+			)
+			return pr, nil
+		}
+		logger.Info("pull-request",
+			zap.String("project", p.Path),
+			zap.Int("number", pr.Number),
+			zap.String("url", pr.URL),
+			zap.Bool("created", pr.Created),
+		)
+		return pr, nil
 	}
-	return nil
+	return nil, nil
 }
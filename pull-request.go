@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/google/go-github/v35/github"
+	"go.uber.org/zap"
+)
+
+// pullRequest is the outcome of opening or updating a pull-request.
+type pullRequest struct {
+	Number  int
+	URL     string
+	Created bool // false if an already opened pull-request was updated
+}
+
+// tokenTransport authenticates the requests made against the GitHub API.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// newGitHubClient returns a GitHub API client authenticated with $GITHUB_TOKEN.
+//
+// $GITHUB_API_URL can be used to target a GitHub Enterprise instance, i.e., "https://ghe.example.com/api/v3/".
+func newGitHubClient() (*github.Client, error) {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		httpClient.Transport = &tokenTransport{token: token, base: http.DefaultTransport}
+	}
+	client := github.NewClient(httpClient)
+
+	if apiURL := os.Getenv("GITHUB_API_URL"); apiURL != "" {
+		if !strings.HasSuffix(apiURL, "/") {
+			apiURL += "/"
+		}
+		baseURL, err := url.Parse(apiURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $GITHUB_API_URL: %w", err)
+		}
+		client.BaseURL = baseURL
+	}
+	return client, nil
+}
+
+// findPullRequest returns the opened pull-request of the head branch, or nil.
+func findPullRequest(ctx context.Context, client *github.Client, owner, repo, head, base string) (*github.PullRequest, error) {
+	existing, _, err := client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+		State: "open",
+		Head:  owner + ":" + head,
+		Base:  base,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GH API: list pull-requests: %w", err)
+	}
+	if len(existing) == 0 {
+		return nil, nil
+	}
+	return existing[0], nil
+}
+
+// upsertPullRequest updates the opened pull-request of the head branch, or creates a new one.
+func upsertPullRequest(ctx context.Context, client *github.Client, owner, repo, head, base, title, body string) (*pullRequest, error) {
+	existing, err := findPullRequest(ctx, client, owner, repo, head, base)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		number := existing.GetNumber()
+		pr, _, err := client.PullRequests.Edit(ctx, owner, repo, number, &github.PullRequest{
+			Title: github.String(title),
+			Body:  github.String(body),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("GH API: edit pull-request #%d: %w", number, err)
+		}
+		return &pullRequest{Number: pr.GetNumber(), URL: pr.GetHTMLURL()}, nil
+	}
+
+	pr, _, err := client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+		Title:               github.String(title),
+		Head:                github.String(head),
+		Base:                github.String(base),
+		Body:                github.String(body),
+		MaintainerCanModify: github.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GH API: create pull-request: %w", err)
+	}
+	return &pullRequest{Number: pr.GetNumber(), URL: pr.GetHTMLURL(), Created: true}, nil
+}
+
+// fileChange is a file modified by the current run, listed in the pull-request's body.
+type fileChange struct {
+	Path    string // relative to the git root
+	Deleted bool
+	Added   bool
+}
+
+// captureChanges returns the changes made to the tracked files, untracked files are ignored like with "git commit -a".
+func (p *project) captureChanges() ([]fileChange, error) {
+	if err := p.updateStatus(); err != nil {
+		return nil, fmt.Errorf("update status: %w", err)
+	}
+	changes := []fileChange{}
+	for path, fileStatus := range p.Git.status {
+		if fileStatus.Staging == git.Untracked || (fileStatus.Staging == git.Unmodified && fileStatus.Worktree == git.Unmodified) {
+			continue
+		}
+		changes = append(changes, fileChange{
+			Path:    path,
+			Deleted: fileStatus.Staging == git.Deleted || fileStatus.Worktree == git.Deleted,
+			Added:   fileStatus.Staging == git.Added,
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// runPatch returns the changes made to the tracked files since HEAD, as a patch that can be applied with "git apply".
+func (p *project) runPatch(ctx context.Context) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "diff", "--binary", "--full-index", "HEAD")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Dir = p.Git.Root
+	cmd.Env = os.Environ()
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git diff: %w: %s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// applyPatch applies a patch made with runPatch on the worktree and the index, with a three-way merge
+// so that the changes made to the same files by other commits are kept.
+// On conflict, the worktree and the index are reset to HEAD.
+func (p *project) applyPatch(ctx context.Context, patch []byte) error {
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "apply", "--3way", "--whitespace=nowarn", "-")
+	cmd.Stdin = bytes.NewReader(patch)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.Dir = p.Git.Root
+	cmd.Env = os.Environ()
+	if err := cmd.Run(); err != nil {
+		if resetErr := p.Git.workTree.Reset(&git.ResetOptions{Mode: git.HardReset}); resetErr != nil {
+			return fmt.Errorf("reset after a failed git apply: %w", resetErr)
+		}
+		return fmt.Errorf("git apply: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+func pullRequestBody(changes []fileChange, notes []string) string {
+	var b strings.Builder
+	b.WriteString("more details: https://github.com/moul/repoman\n\n")
+	b.WriteString("Changes in the last run:\n")
+	for _, change := range changes {
+		action := "modified"
+		switch {
+		case change.Deleted:
+			action = "deleted"
+		case change.Added:
+			action = "added"
+		}
+		fmt.Fprintf(&b, "- %s: `%s`\n", action, change.Path)
+	}
+	for _, note := range notes {
+		b.WriteString("\n" + note)
+	}
+	return b.String()
+}
+
+// remoteBranchHash returns the hash of a branch on origin, or a zero hash if it does not exist.
+func (p *project) remoteBranchHash(ctx context.Context, branchRef plumbing.ReferenceName) (plumbing.Hash, error) {
+	refs, err := p.Git.origin.ListContext(ctx, &git.ListOptions{Auth: p.gitAuth()})
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("list origin refs: %w", err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == branchRef {
+			return ref.Hash(), nil
+		}
+	}
+	return plumbing.ZeroHash, nil
+}
+
+// appendToBranch checks out the branch of an opened pull-request, and replays the changes of the run on top of it,
+// so that the commits pushed by humans are kept.
+//
+// If the changes conflict with these commits, the run's changes are restored on the original HEAD, and an error
+// is returned unless opts.Force is set; false is then returned, and the branch is overwritten by the caller.
+func (p *project) appendToBranch(ctx context.Context, opts projectOpts, branchRef plumbing.ReferenceName, remoteHash plumbing.Hash) (bool, error) {
+	branchName := branchRef.Short()
+	patch, err := p.runPatch(ctx)
+	if err != nil {
+		return false, err
+	}
+	head, err := p.Git.repo.Head()
+	if err != nil {
+		return false, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	err = p.Git.origin.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:refs/remotes/origin/%s", branchRef, branchName))},
+		Auth:     p.gitAuth(),
+	})
+	switch err {
+	case git.NoErrAlreadyUpToDate: // skip
+	case nil: // skip
+	default:
+		return false, fmt.Errorf("fetch %q: %w", branchName, err)
+	}
+	if err := p.Git.repo.Storer.SetReference(plumbing.NewHashReference(branchRef, remoteHash)); err != nil {
+		return false, fmt.Errorf("create branch %q: %w", branchName, err)
+	}
+	if err := p.Git.workTree.Checkout(&git.CheckoutOptions{Branch: branchRef, Force: true}); err != nil {
+		return false, fmt.Errorf("checkout branch %q: %w", branchName, err)
+	}
+	applyErr := p.applyPatch(ctx, patch)
+	if applyErr == nil {
+		return true, nil
+	}
+
+	// conflict, restore the run's changes where they were made
+	checkout := &git.CheckoutOptions{Force: true}
+	if head.Name().IsBranch() {
+		checkout.Branch = head.Name()
+	} else {
+		checkout.Hash = head.Hash()
+	}
+	if err := p.Git.workTree.Checkout(checkout); err != nil {
+		return false, fmt.Errorf("checkout %q: %w", head.Name().Short(), err)
+	}
+	if err := p.applyPatch(ctx, patch); err != nil {
+		return false, fmt.Errorf("restore the changes: %w", err)
+	}
+	if !opts.Force {
+		_ = p.Git.repo.Storer.RemoveReference(branchRef)
+		return false, fmt.Errorf("the changes conflict with the commits of %q, use -force to overwrite it: %w", branchName, applyErr)
+	}
+	logger.Warn("the changes conflict with the branch, overwriting it", zap.String("branch", branchName), zap.Error(applyErr))
+	return false, nil
+}
+
+// openPR commits the current changes on branchName, pushes it and opens or updates its pull-request.
+//
+// If the branch already has an opened pull-request, the changes are committed on top of it, so that
+// commits pushed by humans are kept; a conflict with them is an error, unless opts.Force is set.
+// Otherwise, an existing remote branch is only overwritten when opts.Force is set.
+// On forges without pull-request support, the branch is only pushed, and the changes are appended
+// to an existing one; the returned pull-request is then empty.
+// It returns nil if there is nothing to push.
+//
+//nolint:gocognit,gocyclo
+func (p *project) openPR(ctx context.Context, opts projectOpts, branchName string, title string) (*pullRequest, error) {
+	logger.Debug("opening a PR", zap.String("branch", branchName), zap.String("title", title))
+	supported := p.Git.Forge == forgeGitHub
+
+	changes, err := p.captureChanges()
+	if err != nil {
+		return nil, fmt.Errorf("capture changes: %w", err)
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	body := pullRequestBody(changes, p.notes)
+
+	var (
+		client   *github.Client
+		existing *github.PullRequest
+	)
+	if supported {
+		client, err = newGitHubClient()
+		if err != nil {
+			return nil, fmt.Errorf("init GitHub client: %w", err)
+		}
+		existing, err = findPullRequest(ctx, client, p.Git.RepoOwner, p.Git.RepoName, branchName, p.Git.MainBranch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(branchName)
+	remoteHash, err := p.remoteBranchHash(ctx, branchRef)
+	if err != nil {
+		return nil, err
+	}
+	appendToBranch := false
+	switch {
+	case remoteHash.IsZero():
+		// new branch
+	case opts.Force:
+		logger.Warn("overwriting remote branch", zap.String("branch", branchName), zap.String("hash", remoteHash.String()))
+	case !supported:
+		logger.Debug("updating existing branch", zap.String("branch", branchName))
+		appendToBranch = true
+	case existing == nil:
+		return nil, fmt.Errorf("remote branch %q exists without an opened pull-request, use -force to overwrite it", branchName) //nolint:goerr113
+	default:
+		logger.Debug("updating existing pull-request", zap.Int("number", existing.GetNumber()))
+		appendToBranch = true
+	}
+
+	// commit changes on the branch
+	{
+		if appendToBranch {
+			appendToBranch, err = p.appendToBranch(ctx, opts, branchRef, remoteHash)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !appendToBranch {
+			head, err := p.Git.repo.Head()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get HEAD: %w", err)
+			}
+			if err := p.Git.repo.Storer.SetReference(plumbing.NewHashReference(branchRef, head.Hash())); err != nil {
+				return nil, fmt.Errorf("create branch %q: %w", branchName, err)
+			}
+			if err := p.Git.workTree.Checkout(&git.CheckoutOptions{Branch: branchRef, Keep: true}); err != nil {
+				return nil, fmt.Errorf("checkout branch %q: %w", branchName, err)
+			}
+		}
+		p.Git.CurrentBranch = branchName
+		p.Git.InMainBranch = false
+
+		remaining, err := p.captureChanges()
+		if err != nil {
+			return nil, fmt.Errorf("capture changes: %w", err)
+		}
+		if len(remaining) == 0 {
+			logger.Info("branch already contains the changes", zap.String("branch", branchName))
+		} else {
+			signature := gitSignature(p.Git.repo)
+			message := fmt.Sprintf("%s\n\n%s\nSigned-off-by: %s <%s>\n", title, body, signature.Name, signature.Email)
+			_, err = p.Git.workTree.Commit(message, &git.CommitOptions{
+				All:       true,
+				Author:    signature,
+				Committer: signature,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("commit: %w", err)
+			}
+		}
+	}
+
+	// push
+	{
+		refSpec := fmt.Sprintf("%s:%s", branchRef, branchRef)
+		if !appendToBranch {
+			refSpec = "+" + refSpec
+		}
+		logger.Debug("push branch", zap.String("refspec", refSpec))
+		err := p.Git.repo.PushContext(ctx, &git.PushOptions{
+			RemoteName: "origin",
+			RefSpecs:   []config.RefSpec{config.RefSpec(refSpec)},
+			Auth:       p.gitAuth(),
+			Progress:   os.Stderr,
+		})
+		switch err {
+		case git.NoErrAlreadyUpToDate: // skip
+		case nil: // skip
+		default:
+			return nil, fmt.Errorf("push %q: %w", branchName, err)
+		}
+	}
+
+	if !supported {
+		return &pullRequest{}, nil
+	}
+
+	// open or update the pull-request
+	pr, err := upsertPullRequest(ctx, client, p.Git.RepoOwner, p.Git.RepoName, branchName, p.Git.MainBranch, title, body)
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
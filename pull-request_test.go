@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+	"go.uber.org/zap"
+)
+
+// fakeGitHub is a minimal stand-in of the GitHub pull-requests API.
+type fakeGitHub struct {
+	opened map[string]int // head branch -> PR number
+	edits  int
+	body   string // of the last created or edited pull-request
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/repos/moul/repoman/pulls"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == prefix:
+		ret := []*github.PullRequest{}
+		if number, found := f.opened[r.URL.Query().Get("head")]; found {
+			ret = append(ret, &github.PullRequest{Number: github.Int(number)})
+		}
+		_ = json.NewEncoder(w).Encode(ret)
+	case r.Method == http.MethodPost && r.URL.Path == prefix:
+		var req github.NewPullRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.body = req.GetBody()
+		number := len(f.opened) + 42
+		f.opened["moul:"+req.GetHead()] = number
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(&github.PullRequest{Number: github.Int(number), HTMLURL: github.String("https://github.com/moul/repoman/pull/42")})
+	case r.Method == http.MethodPatch && r.URL.Path == prefix+"/42":
+		f.edits++
+		var req github.PullRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.body = req.GetBody()
+		_ = json.NewEncoder(w).Encode(&github.PullRequest{Number: github.Int(42), HTMLURL: github.String("https://github.com/moul/repoman/pull/42")})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestUpsertPullRequest(t *testing.T) {
+	fake := &fakeGitHub{opened: map[string]int{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := github.NewClient(server.Client())
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	ctx := context.Background()
+
+	pr, err := upsertPullRequest(ctx, client, "moul", "repoman", "dev/moul/maintenance", "main", "chore: maintenance", "body")
+	if err != nil {
+		t.Fatalf("err should be nil: %v", err)
+	}
+	expected := pullRequest{Number: 42, URL: "https://github.com/moul/repoman/pull/42", Created: true}
+	if *pr != expected {
+		t.Errorf("expected %+v, got %+v", expected, *pr)
+	}
+
+	pr, err = upsertPullRequest(ctx, client, "moul", "repoman", "dev/moul/maintenance", "main", "chore: maintenance", "new body")
+	if err != nil {
+		t.Fatalf("err should be nil: %v", err)
+	}
+	expected.Created = false
+	if *pr != expected {
+		t.Errorf("expected %+v, got %+v", expected, *pr)
+	}
+	if fake.edits != 1 {
+		t.Errorf("expected the existing pull-request to be edited once, got %d", fake.edits)
+	}
+}
+
+func TestOpenPRAppend(t *testing.T) {
+	logger = zap.NewNop()
+	fake := &fakeGitHub{opened: map[string]int{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	t.Setenv("GITHUB_API_URL", server.URL+"/")
+	t.Setenv("GITHUB_TOKEN", "")
+	for _, key := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(key+"_NAME", "t")
+		t.Setenv(key+"_EMAIL", "t@t")
+	}
+	const branch = "dev/moul/maintenance"
+	ctx := context.Background()
+
+	git := func(dir string, args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return string(out)
+	}
+	// content returns a file of 9 lines, with some lines changed
+	content := func(changed map[int]string) string {
+		var b strings.Builder
+		for i := 1; i <= 9; i++ {
+			line, found := changed[i]
+			if !found {
+				line = fmt.Sprintf("line%d", i)
+			}
+			b.WriteString(line + "\n")
+		}
+		return b.String()
+	}
+	write := func(dir string, changed map[int]string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, "FILE.txt"), []byte(content(changed)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	origin := t.TempDir()
+	git(origin, "init", "-q", "--bare", "-b", "main")
+	work := t.TempDir()
+	git(work, "clone", "-q", origin, ".")
+	write(work, nil)
+	git(work, "add", "FILE.txt")
+	git(work, "commit", "-qm", "initial")
+	git(work, "push", "-q", "origin", "main")
+
+	// run makes changes on main, like a maintenance run, and pushes them on a pull-request
+	run := func(branch string, force bool, changed map[int]string) error {
+		git(work, "checkout", "-q", "-f", "main")
+		write(work, changed)
+		p, err := projectFromPath(work)
+		if err != nil {
+			t.Fatalf("project: %v", err)
+		}
+		p.Git.Forge, p.Git.RepoOwner, p.Git.RepoName = forgeGitHub, "moul", "repoman"
+		_, err = p.openPR(ctx, projectOpts{Force: force}, branch, "chore: repo maintenance")
+		return err
+	}
+	// human pushes a fixup on the branch
+	human := func(changed map[int]string) {
+		other := t.TempDir()
+		git(other, "clone", "-q", "-b", branch, origin, ".")
+		write(other, changed)
+		git(other, "commit", "-qam", "human fixup")
+		git(other, "push", "-q", "origin", branch)
+	}
+	remote := func(branch string) string {
+		return git(origin, "show", branch+":FILE.txt")
+	}
+
+	// new branch
+	if err := run(branch, false, map[int]string{1: "run1"}); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if got, expected := remote(branch), content(map[int]string{1: "run1"}); got != expected {
+		t.Errorf("first run: expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// the human fixup to the same file survives the next run
+	human(map[int]string{1: "run1", 9: "human9"})
+	if err := run(branch, false, map[int]string{1: "run1", 5: "run5"}); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if got, expected := remote(branch), content(map[int]string{1: "run1", 5: "run5", 9: "human9"}); got != expected {
+		t.Errorf("second run: expected:\n%s\ngot:\n%s", expected, got)
+	}
+	if log := git(origin, "log", "--format=%s", branch); !strings.Contains(log, "human fixup") {
+		t.Errorf("expected the human commit to be kept, got:\n%s", log)
+	}
+	if fake.edits != 1 {
+		t.Errorf("expected the pull-request to be edited, got %d edits", fake.edits)
+	}
+
+	// a conflicting run is refused, and its changes are left on main
+	human(map[int]string{1: "run1", 5: "human5", 9: "human9"})
+	conflicting := map[int]string{1: "run1", 5: "run5-bis"}
+	err := run(branch, false, conflicting)
+	if err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+	if got, expected := remote(branch), content(map[int]string{1: "run1", 5: "human5", 9: "human9"}); got != expected {
+		t.Errorf("expected the branch to be untouched, got:\n%s", got)
+	}
+	if current := strings.TrimSpace(git(work, "rev-parse", "--abbrev-ref", "HEAD")); current != "main" {
+		t.Errorf("expected to be back on main, got %q", current)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(work, "FILE.txt")); string(got) != content(conflicting) {
+		t.Errorf("expected the changes to be restored, got:\n%s", got)
+	}
+
+	// with -force, the branch is overwritten
+	if err := run(branch, true, conflicting); err != nil {
+		t.Fatalf("forced run: %v", err)
+	}
+	if got, expected := remote(branch), content(conflicting); got != expected {
+		t.Errorf("forced run: expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// a remote branch without opened pull-request is never overwritten without -force
+	git(work, "push", "-q", "origin", "main:refs/heads/dev/moul/other")
+	if err := run("dev/moul/other", false, conflicting); err == nil || !strings.Contains(err.Error(), "without an opened pull-request") {
+		t.Errorf("expected the branch to be refused, got %v", err)
+	}
+}
+
+func TestOpenPRUnsupportedForge(t *testing.T) {
+	logger = zap.NewNop()
+	t.Setenv("GITHUB_API_URL", "http://127.0.0.1:0/") // any call to the GitHub API fails
+	for _, key := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(key+"_NAME", "t")
+		t.Setenv(key+"_EMAIL", "t@t")
+	}
+	const branch = "dev/moul/maintenance"
+	ctx := context.Background()
+
+	git := func(dir string, args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return string(out)
+	}
+	origin := t.TempDir()
+	git(origin, "init", "-q", "--bare", "-b", "main")
+	work := t.TempDir()
+	git(work, "clone", "-q", origin, ".")
+	git(work, "commit", "-q", "--allow-empty", "-m", "initial")
+	git(work, "push", "-q", "origin", "main")
+
+	// each run changes another file, so the second one is appended to the pushed branch
+	for i, file := range []string{"A.txt", "B.txt"} {
+		git(work, "checkout", "-q", "-f", "main")
+		if err := ioutil.WriteFile(filepath.Join(work, file), []byte("bar\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git(work, "add", file)
+		p, err := projectFromPath(work)
+		if err != nil {
+			t.Fatalf("project: %v", err)
+		}
+		p.Git.Forge, p.Git.RepoOwner, p.Git.RepoName = forgeGitLab, "moul", "repoman"
+		pr, err := p.openPR(ctx, projectOpts{}, branch, "chore: repo maintenance")
+		if err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		if pr == nil || pr.Number != 0 {
+			t.Errorf("run %d: expected an empty pull-request, got %+v", i, pr)
+		}
+		if got := git(origin, "show", branch+":"+file); got != "bar\n" {
+			t.Errorf("run %d: expected the branch to be pushed with %s, got %q", i, file, got)
+		}
+	}
+	if count := strings.Count(git(origin, "log", "--format=%s", branch), "chore: repo maintenance"); count != 2 {
+		t.Errorf("expected the second run to be appended to the branch, got %d commits", count)
+	}
+}
+
+func TestGitSignature(t *testing.T) {
+	logger = zap.NewNop()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_AUTHOR_NAME", "")
+	t.Setenv("GIT_AUTHOR_EMAIL", "")
+
+	if s := gitSignature(nil); s.Name != "repoman" || s.Email != "repoman@localhost" {
+		t.Errorf("expected the default identity, got %s <%s>", s.Name, s.Email)
+	}
+
+	dir := newTestProject(t)
+	p, err := projectFromPath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[user]\n\tname = Global\n\temail = global@example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if s := gitSignature(p.Git.repo); s.Name != "Global" || s.Email != "global@example.com" {
+		t.Errorf("expected the global identity, got %s <%s>", s.Name, s.Email)
+	}
+	if out, err := exec.Command("git", "-C", dir, "config", "user.name", "Local").CombinedOutput(); err != nil {
+		t.Fatalf("git config: %v: %s", err, out)
+	}
+	t.Setenv("GIT_AUTHOR_EMAIL", "env@example.com")
+	if s := gitSignature(p.Git.repo); s.Name != "Local" || s.Email != "env@example.com" {
+		t.Errorf("expected the local name and the environment email, got %s <%s>", s.Name, s.Email)
+	}
+}
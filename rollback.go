@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// onFailure actions, see -on-failure.
+const (
+	onFailureRollback = "rollback"
+	onFailureRescue   = "rescue"
+	onFailureKeep     = "keep"
+)
+
+// worktreeSnapshot is the state of a project before a write command, used to restore it when the command fails.
+type worktreeSnapshot struct {
+	Branch string // empty if HEAD is detached
+	Hash   string
+	Index  []byte
+	Dirty  bool
+}
+
+func (p *project) snapshot() (*worktreeSnapshot, error) {
+	head, err := p.Git.repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("get HEAD: %w", err)
+	}
+	s := &worktreeSnapshot{Hash: head.Hash().String()}
+	if head.Name().IsBranch() {
+		s.Branch = head.Name().Short()
+	}
+	if err := p.updateStatus(); err != nil {
+		return nil, fmt.Errorf("update status: %w", err)
+	}
+	s.Dirty = *p.Git.IsDirty
+	index, err := ioutil.ReadFile(filepath.Join(p.Git.Root, ".git", "index"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read git index: %w", err)
+	}
+	s.Index = index
+	return s, nil
+}
+
+// restore checks out the snapshotted branch and resets the worktree and the index to their snapshotted state.
+//
+// The files created since the snapshot are removed, the ignored ones are kept.
+func (p *project) restore(s *worktreeSnapshot) error {
+	// the command may have failed because the context was canceled
+	ctx := context.Background()
+	target := s.Hash
+	if s.Branch != "" {
+		target = s.Branch
+	}
+	if err := runCommandInDir(ctx, p.Git.Root, "git", "checkout", "-q", "-f", target); err != nil {
+		return err
+	}
+	if err := runCommandInDir(ctx, p.Git.Root, "git", "reset", "-q", "--hard", s.Hash); err != nil {
+		return err
+	}
+	if err := runCommandInDir(ctx, p.Git.Root, "git", "clean", "-q", "-f", "-d"); err != nil {
+		return err
+	}
+	if s.Index != nil {
+		if err := ioutil.WriteFile(filepath.Join(p.Git.Root, ".git", "index"), s.Index, 0o644); err != nil { //nolint:gosec
+			return fmt.Errorf("restore git index: %w", err)
+		}
+	}
+	return nil
+}
+
+// rescue commits the changes made since the snapshot on a new branch, then restores the snapshot.
+func (p *project) rescue(s *worktreeSnapshot, command string, cause error) (string, error) {
+	ctx := context.Background()
+	branch := fmt.Sprintf("repoman/rescue/%s-%s", command, time.Now().Format("20060102-150405"))
+	signature := gitSignature(p.Git.repo)
+	message := fmt.Sprintf("wip: %s failed 🤖\n\n%v", command, cause)
+	script := []string{
+		"git checkout -q -b \"$1\"",
+		"git add -A",
+		"git -c user.name=\"$2\" -c user.email=\"$3\" commit -q --no-verify --allow-empty -m \"$4\"",
+	}
+	for _, line := range script {
+		args := []string{"-ec", line, "rescue", branch, signature.Name, signature.Email, message}
+		if err := runCommandInDir(ctx, p.Git.Root, "/bin/sh", args...); err != nil {
+			return "", err
+		}
+	}
+	return branch, p.restore(s)
+}
+
+// changesKeptError is returned by a command that failed but kept its changes on purpose,
+// i.e., maintenance pushes the changes of the tasks that succeeded; they are not rolled back.
+type changesKeptError struct{ err error }
+
+func (e *changesKeptError) Error() string { return e.err.Error() }
+func (e *changesKeptError) Unwrap() error { return e.err }
+
+// handleFailure applies the -on-failure action after a failed write command, and returns the error completed
+// with what was done.
+func (p *project) handleFailure(s *worktreeSnapshot, action, command string, cause error) error {
+	switch {
+	case action == onFailureKeep:
+		return fmt.Errorf("%w (worktree left as is)", cause)
+	case s.Dirty:
+		// the worktree was already dirty, restoring it would lose the user's changes
+		return fmt.Errorf("%w (worktree was dirty before running, left as is)", cause)
+	case action == onFailureRescue:
+		branch, err := p.rescue(s, command, cause)
+		if err != nil {
+			return multierr.Append(cause, fmt.Errorf("rescue: %w", err))
+		}
+		logger.Warn("changes saved on a rescue branch", zap.String("project", p.Path), zap.String("branch", branch))
+		return fmt.Errorf("%w (changes saved on branch %q, worktree restored to %s)", cause, branch, s.Hash[:7])
+	default:
+		if err := p.restore(s); err != nil {
+			return multierr.Append(cause, fmt.Errorf("rollback: %w", err))
+		}
+		logger.Warn("worktree rolled back", zap.String("project", p.Path), zap.String("commit", s.Hash))
+		return fmt.Errorf("%w (worktree rolled back to %s)", cause, s.Hash[:7])
+	}
+}
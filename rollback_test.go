@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"moul.io/u"
+)
+
+func TestRunWriteCommandOnFailure(t *testing.T) {
+	failing := func(p *project) error {
+		if err := ioutil.WriteFile(filepath.Join(p.Path, "README.md"), []byte("half-rewritten\n"), 0); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(p.Path, "NEW.md"), []byte("new\n"), 0o644); err != nil {
+			return err
+		}
+		if _, err := p.Git.workTree.Add("NEW.md"); err != nil {
+			return err
+		}
+		return errors.New("make generate failed") //nolint:goerr113
+	}
+	git := func(dir string, args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	for _, action := range []string{onFailureRollback, onFailureRescue} {
+		dir := newTestProject(t)
+		head := git(dir, "rev-parse", "HEAD")
+
+		err := runWriteCommand(context.Background(), "test", dir, projectOpts{OnFailure: action}, failing)
+		if err == nil || !strings.Contains(err.Error(), "make generate failed") {
+			t.Fatalf("%s: expected the command's error, got %v", action, err)
+		}
+		if content, _ := ioutil.ReadFile(filepath.Join(dir, "README.md")); string(content) != "hello\n" {
+			t.Errorf("%s: README.md was not restored: %q", action, content)
+		}
+		if u.FileExists(filepath.Join(dir, "NEW.md")) {
+			t.Errorf("%s: NEW.md was not removed", action)
+		}
+		if status := git(dir, "status", "--porcelain"); status != "" {
+			t.Errorf("%s: expected a clean worktree, got %q", action, status)
+		}
+		if got := git(dir, "rev-parse", "HEAD"); got != head {
+			t.Errorf("%s: expected HEAD to be %s, got %s", action, head, got)
+		}
+
+		switch action {
+		case onFailureRollback:
+			if !strings.Contains(err.Error(), "rolled back") {
+				t.Errorf("expected the rollback to be reported, got %v", err)
+			}
+		case onFailureRescue:
+			branches := git(dir, "branch", "--list", "repoman/rescue/test-*", "--format=%(refname:short)")
+			if branches == "" || !strings.Contains(err.Error(), branches) {
+				t.Fatalf("expected the rescue branch %q to be reported, got %v", branches, err)
+			}
+			if content := git(dir, "show", branches+":README.md"); content != "half-rewritten" {
+				t.Errorf("expected the changes on the rescue branch, got %q", content)
+			}
+		}
+	}
+}
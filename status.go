@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// repomanBranchPrefix is the prefix of the branches pushed by the write commands, i.e., dev/moul/maintenance.
+const repomanBranchPrefix = "dev/moul/"
+
+// repoStatus is a row of the status table.
+type repoStatus struct {
+	Path       string
+	Branch     string
+	MainBranch string
+	Dirty      bool
+	Ahead      int // -1 without upstream branch
+	Behind     int
+	LastCommit time.Time
+	PRs        []int // nil when unknown
+	Score      int   // doctor score, in percent
+}
+
+// statusSortKeys are the columns the table can be sorted by, see -sort.
+var statusSortKeys = map[string]func(a, b *repoStatus) bool{
+	"path":   func(a, b *repoStatus) bool { return a.Path < b.Path },
+	"branch": func(a, b *repoStatus) bool { return a.Branch < b.Branch },
+	"dirty":  func(a, b *repoStatus) bool { return a.Dirty && !b.Dirty },
+	"ahead":  func(a, b *repoStatus) bool { return a.Ahead > b.Ahead },
+	"behind": func(a, b *repoStatus) bool { return a.Behind > b.Behind },
+	"age":    func(a, b *repoStatus) bool { return a.LastCommit.Before(b.LastCommit) },
+	"pr":     func(a, b *repoStatus) bool { return len(a.PRs) > len(b.PRs) },
+	"score":  func(a, b *repoStatus) bool { return a.Score < b.Score },
+}
+
+// statusFilters are the conditions a row can be filtered by, see -filter.
+var statusFilters = map[string]func(s *repoStatus) bool{
+	"dirty":    func(s *repoStatus) bool { return s.Dirty },
+	"clean":    func(s *repoStatus) bool { return !s.Dirty },
+	"off-main": func(s *repoStatus) bool { return s.Branch != s.MainBranch },
+	"ahead":    func(s *repoStatus) bool { return s.Ahead > 0 },
+	"behind":   func(s *repoStatus) bool { return s.Behind > 0 },
+	"pr":       func(s *repoStatus) bool { return len(s.PRs) > 0 },
+	"failing":  func(s *repoStatus) bool { return s.Score < 100 },
+}
+
+func doStatus(ctx context.Context, args []string) error {
+	less, ok := statusSortKeys[opts.Status.Sort]
+	if !ok {
+		return fmt.Errorf("invalid -sort: %q", opts.Status.Sort) //nolint:goerr113
+	}
+	filters := splitList(opts.Status.Filter)
+	for _, filter := range filters {
+		if _, ok := statusFilters[filter]; !ok {
+			return fmt.Errorf("unknown -filter: %q", filter) //nolint:goerr113
+		}
+	}
+	paths, err := targetPaths(args)
+	if err != nil {
+		return err
+	}
+	logger.Debug("doStatus", zap.Any("opts", opts), zap.Strings("projects", paths))
+
+	var client *github.Client
+	if opts.Status.PRs {
+		client, err = newGitHubClient()
+		if err != nil {
+			return err
+		}
+	}
+
+	var (
+		errs     error
+		statuses []*repoStatus
+		mutex    sync.Mutex
+	)
+	g, ctx := errgroup.WithContext(ctx)
+	for _, path := range paths {
+		path := path
+		g.Go(func() error {
+			status, err := doStatusOnce(ctx, path, client)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("%q: %w", path, err))
+				return nil
+			}
+			if matchStatusFilters(status, filters) {
+				statuses = append(statuses, status)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	sortStatuses(statuses, less, opts.Status.Reverse)
+	fmt.Print(statusTable(statuses, time.Now()))
+	return errs
+}
+
+func doStatusOnce(ctx context.Context, path string, client *github.Client) (*repoStatus, error) {
+	project, err := projectFromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid project: %w", err)
+	}
+	if project.Git.Root == "" {
+		return nil, fmt.Errorf("not implemented: non-git projects") //nolint:goerr113
+	}
+	return project.status(ctx, client)
+}
+
+// status computes the row of the project, the open pull-requests are only looked up with a client.
+func (p *project) status(ctx context.Context, client *github.Client) (*repoStatus, error) {
+	status := &repoStatus{
+		Path:       p.Path,
+		Branch:     p.Git.CurrentBranch,
+		MainBranch: p.Git.MainBranch,
+		Ahead:      -1,
+	}
+	if err := p.updateStatus(); err != nil {
+		return nil, fmt.Errorf("update status: %w", err)
+	}
+	status.Dirty = *p.Git.IsDirty
+
+	if head, err := p.Git.repo.Head(); err == nil {
+		commit, err := p.Git.repo.CommitObject(head.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("get HEAD commit: %w", err)
+		}
+		status.LastCommit = commit.Committer.When
+	}
+
+	// ahead/behind the upstream branch, or the branch with the same name on origin
+	for _, upstream := range []string{"@{upstream}", "origin/" + p.Git.CurrentBranch} {
+		var stdout bytes.Buffer
+		cmd := exec.CommandContext(ctx, "git", "rev-list", "--left-right", "--count", "HEAD..."+upstream)
+		cmd.Stdout = &stdout
+		cmd.Dir = p.Git.Root
+		if err := cmd.Run(); err != nil {
+			continue
+		}
+		fields := strings.Fields(stdout.String())
+		if len(fields) == 2 {
+			status.Ahead, _ = strconv.Atoi(fields[0])
+			status.Behind, _ = strconv.Atoi(fields[1])
+			break
+		}
+	}
+
+	if client != nil && p.Git.Forge == forgeGitHub {
+		prs, _, err := client.PullRequests.List(ctx, p.Git.RepoOwner, p.Git.RepoName, &github.PullRequestListOptions{
+			State:       "open",
+			ListOptions: github.ListOptions{PerPage: 100},
+		})
+		if err != nil {
+			logger.Warn("cannot list pull-requests", zap.String("project", p.Path), zap.Error(err))
+		} else {
+			status.PRs = []int{}
+			for _, pr := range prs {
+				if strings.HasPrefix(pr.GetHead().GetRef(), repomanBranchPrefix) {
+					status.PRs = append(status.PRs, pr.GetNumber())
+				}
+			}
+			sort.Ints(status.PRs)
+		}
+	}
+
+	report, err := doDoctorProject(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("doctor: %w", err)
+	}
+	status.Score = report.score()
+	return status, nil
+}
+
+// matchStatusFilters returns whether the row matches all the filters.
+func matchStatusFilters(status *repoStatus, filters []string) bool {
+	for _, filter := range filters {
+		if !statusFilters[filter](status) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortStatuses sorts the rows with less, then by path.
+func sortStatuses(statuses []*repoStatus, less func(a, b *repoStatus) bool, reverse bool) {
+	sort.SliceStable(statuses, func(i, j int) bool { return statuses[i].Path < statuses[j].Path })
+	sort.SliceStable(statuses, func(i, j int) bool {
+		if reverse {
+			return less(statuses[j], statuses[i])
+		}
+		return less(statuses[i], statuses[j])
+	})
+}
+
+// statusTable returns the rows as an aligned table.
+func statusTable(statuses []*repoStatus, now time.Time) string {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tBRANCH\tMAIN\tDIRTY\tAHEAD/BEHIND\tLAST COMMIT\tPR\tDOCTOR")
+	for _, s := range statuses {
+		dirty := ""
+		if s.Dirty {
+			dirty = "yes"
+		}
+		aheadBehind := "-"
+		if s.Ahead >= 0 {
+			aheadBehind = fmt.Sprintf("+%d/-%d", s.Ahead, s.Behind)
+		}
+		lastCommit := "-"
+		if !s.LastCommit.IsZero() {
+			lastCommit = formatAge(now.Sub(s.LastCommit)) + " ago"
+		}
+		prs := "?"
+		switch {
+		case s.PRs == nil:
+		case len(s.PRs) == 0:
+			prs = "-"
+		default:
+			numbers := make([]string, 0, len(s.PRs))
+			for _, number := range s.PRs {
+				numbers = append(numbers, "#"+strconv.Itoa(number))
+			}
+			prs = strings.Join(numbers, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d%%\n", s.Path, s.Branch, s.MainBranch, dirty, aheadBehind, lastCommit, prs, s.Score)
+	}
+	_ = w.Flush()
+	return b.String()
+}
+
+// formatAge returns a short human-readable duration, i.e., "5m", "3h", "12d", "4mo" or "2y".
+func formatAge(d time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < 2*day:
+		return fmt.Sprintf("%dh", int(d/time.Hour))
+	case d < 60*day:
+		return fmt.Sprintf("%dd", int(d/day))
+	case d < 2*365*day:
+		return fmt.Sprintf("%dmo", int(d/(30*day)))
+	default:
+		return fmt.Sprintf("%dy", int(d/(365*day)))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProjectStatus(t *testing.T) {
+	dir := newTestProject(t)
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	project, err := projectFromPath(dir)
+	if err != nil {
+		t.Fatalf("project: %v", err)
+	}
+	status, err := project.status(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	switch {
+	case status.Path != dir, status.Branch != "master":
+		t.Errorf("unexpected path or branch: %+v", status)
+	case !status.Dirty:
+		t.Errorf("expected the project to be dirty")
+	case status.Ahead != -1:
+		t.Errorf("expected no upstream, got %+v", status)
+	case status.PRs != nil:
+		t.Errorf("expected the pull-requests to be unknown without client, got %v", status.PRs)
+	case status.Score >= 100:
+		t.Errorf("expected doctor findings, got a score of %d", status.Score)
+	case time.Since(status.LastCommit) > time.Minute:
+		t.Errorf("unexpected last commit: %v", status.LastCommit)
+	}
+}
+
+func TestStatusTable(t *testing.T) {
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	statuses := []*repoStatus{
+		{Path: "a", Branch: "main", MainBranch: "main", Ahead: 0, LastCommit: now.Add(-3 * time.Hour), PRs: []int{}, Score: 100},
+		{Path: "b", Branch: "dev", MainBranch: "main", Dirty: true, Ahead: 2, Behind: 1, LastCommit: now.Add(-90 * 24 * time.Hour), PRs: []int{4, 12}, Score: 80},
+		{Path: "c", Branch: "master", MainBranch: "master", Ahead: -1, Score: 90},
+	}
+
+	var filtered []*repoStatus
+	for _, status := range statuses {
+		if matchStatusFilters(status, []string{"clean", "failing"}) {
+			filtered = append(filtered, status)
+		}
+	}
+	if len(filtered) != 1 || filtered[0].Path != "c" {
+		t.Errorf("unexpected filtered rows: %v", filtered)
+	}
+
+	sortStatuses(statuses, statusSortKeys["score"], false)
+	if order := statuses[0].Path + statuses[1].Path + statuses[2].Path; order != "bca" {
+		t.Errorf("expected the lowest score first, got %s", order)
+	}
+	sortStatuses(statuses, statusSortKeys["path"], true)
+
+	expected := `PATH  BRANCH  MAIN    DIRTY  AHEAD/BEHIND  LAST COMMIT  PR      DOCTOR
+c     master  master         -             -            ?       90%
+b     dev     main    yes    +2/-1         3mo ago      #4,#12  80%
+a     main    main           +0/-0         3h ago       -       100%
+`
+	if got := statusTable(statuses, now); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+	if got := formatAge(30 * time.Minute); got != "30m" {
+		t.Errorf("unexpected age: %q", got)
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-isatty"
+	"gopkg.in/yaml.v3"
+	"moul.io/u"
+)
+
+// templateManifestFilename is the manifest shipped by a template, it is removed from the generated projects.
+const templateManifestFilename = ".repoman-template.yml"
+
+// templateManifest declares the variables and the optional features of a template.
+//
+//	variables:
+//	  - name: description
+//	    placeholder: "A golang repo template"
+//	    default: "TODO: describe the project"
+//	  - name: license
+//	    placeholder: Apache-2.0
+//	    choices: [Apache-2.0, MIT]
+//	features:
+//	  - name: docker
+//	    files: [Dockerfile, .dockerignore]
+//	    makefile-vars: [DOCKER_IMAGE]
+type templateManifest struct {
+	Variables []*templateVariable        `yaml:"variables,omitempty"`
+	Features  []*templateManifestFeature `yaml:"features,omitempty"`
+}
+
+// templateVariable is a string of the template replaced by a value chosen when the project is created.
+type templateVariable struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	// Placeholder is the text of the template replaced by the value.
+	Placeholder string `yaml:"placeholder,omitempty"`
+	// Default is used when no value is given, a variable without default is required.
+	Default string   `yaml:"default,omitempty"`
+	Pattern string   `yaml:"pattern,omitempty"`
+	Choices []string `yaml:"choices,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// templateManifestFeature is an optional part of a template, its files are removed when it is turned off.
+type templateManifestFeature struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	// Default is whether the feature is kept when no value is given, true if unset.
+	Default      *bool    `yaml:"default,omitempty"`
+	Files        []string `yaml:"files,omitempty"`
+	MakefileVars []string `yaml:"makefile-vars,omitempty"`
+}
+
+// loadTemplateManifest reads the template manifest in dir, it returns nil if there is none.
+func loadTemplateManifest(dir string) (*templateManifest, error) {
+	path := filepath.Join(dir, templateManifestFilename)
+	if !u.FileExists(path) {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read template manifest: %q: %w", path, err)
+	}
+	m, err := parseTemplateManifest(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template manifest: %q: %w", path, err)
+	}
+	return m, nil
+}
+
+func parseTemplateManifest(content []byte) (*templateManifest, error) {
+	var m templateManifest
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for _, v := range m.Variables {
+		if v.Name == "" || seen[v.Name] {
+			return nil, fmt.Errorf("empty or duplicate name: %q", v.Name) //nolint:goerr113
+		}
+		seen[v.Name] = true
+		if v.Pattern != "" {
+			re, err := regexp.Compile(v.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern: %w", v.Name, err)
+			}
+			v.pattern = re
+		}
+		if v.Default != "" {
+			if err := v.validate(v.Default); err != nil {
+				return nil, fmt.Errorf("%s: invalid default: %w", v.Name, err)
+			}
+		}
+	}
+	for _, f := range m.Features {
+		if f.Name == "" || seen[f.Name] {
+			return nil, fmt.Errorf("empty or duplicate name: %q", f.Name) //nolint:goerr113
+		}
+		seen[f.Name] = true
+	}
+	return &m, nil
+}
+
+// validate checks a value against the pattern and the choices of the variable.
+func (v *templateVariable) validate(value string) error {
+	if value == "" && v.Default == "" {
+		return fmt.Errorf("a value is required") //nolint:goerr113
+	}
+	if len(v.Choices) > 0 && !containsString(v.Choices, value) {
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(v.Choices, ", ")) //nolint:goerr113
+	}
+	if v.pattern != nil && !v.pattern.MatchString(value) {
+		return fmt.Errorf("%q does not match %s", value, v.Pattern) //nolint:goerr113
+	}
+	return nil
+}
+
+func (m *templateManifest) hasFeature(name string) bool {
+	for _, f := range m.Features {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *templateManifestFeature) enabledByDefault() bool {
+	return f.Default == nil || *f.Default
+}
+
+// prompter asks for a value on a terminal, it is nil when repoman is not run interactively.
+type prompter struct {
+	in *bufio.Reader
+	w  io.Writer
+}
+
+var (
+	// promptMu prevents the projects processed concurrently from prompting at the same time.
+	promptMu sync.Mutex
+	// promptReader is shared by the prompters, so that buffered answers are not lost between projects.
+	promptReader = bufio.NewReader(os.Stdin)
+)
+
+func newPrompter() *prompter {
+	if !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		return nil
+	}
+	return &prompter{in: promptReader, w: os.Stderr}
+}
+
+// ask prints the question until validate accepts the answer, an empty answer selects def.
+func (pr *prompter) ask(question, def string, validate func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(pr.w, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(pr.w, "%s: ", question)
+		}
+		line, err := pr.in.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("read answer: %w", err)
+		}
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		if err := validate(answer); err != nil {
+			fmt.Fprintf(pr.w, "invalid value: %v\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// resolve returns the value of each variable and feature, from set, then from the prompter, then from the defaults.
+//
+// Features are resolved to "true" or "false".
+func (m *templateManifest) resolve(set map[string]string, pr *prompter) (map[string]string, error) {
+	known := map[string]bool{}
+	for _, v := range m.Variables {
+		known[v.Name] = true
+	}
+	for _, f := range m.Features {
+		known[f.Name] = true
+	}
+	for key := range set {
+		if !known[key] {
+			return nil, fmt.Errorf("unknown template variable: %q", key) //nolint:goerr113
+		}
+	}
+
+	if pr != nil {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+	}
+	values := map[string]string{}
+	for _, v := range m.Variables {
+		value, ok := set[v.Name]
+		switch {
+		case ok:
+		case pr != nil:
+			question := v.Name
+			if v.Description != "" {
+				question = fmt.Sprintf("%s (%s)", v.Description, v.Name)
+			}
+			if len(v.Choices) > 0 {
+				question += " " + strings.Join(v.Choices, "/")
+			}
+			var err error
+			if value, err = pr.ask(question, v.Default, v.validate); err != nil {
+				return nil, fmt.Errorf("%s: %w", v.Name, err)
+			}
+		default:
+			value = v.Default
+		}
+		if value == "" {
+			value = v.Default
+		}
+		if err := v.validate(value); err != nil {
+			return nil, fmt.Errorf("%s: %w, use -set %s=<value>", v.Name, err, v.Name)
+		}
+		values[v.Name] = value
+	}
+	for _, f := range m.Features {
+		value, ok := set[f.Name]
+		if !ok && pr != nil {
+			question := f.Name
+			if f.Description != "" {
+				question = fmt.Sprintf("%s (%s)", f.Description, f.Name)
+			}
+			var err error
+			validate := func(s string) error { _, err := parseFeatureValue(s); return err }
+			if value, err = pr.ask(question+"? yes/no", strconv.FormatBool(f.enabledByDefault()), validate); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+		enabled := f.enabledByDefault()
+		if value != "" {
+			var err error
+			if enabled, err = parseFeatureValue(value); err != nil {
+				return nil, fmt.Errorf("%s: invalid boolean %q", f.Name, value) //nolint:goerr113
+			}
+		}
+		values[f.Name] = strconv.FormatBool(enabled)
+	}
+	return values, nil
+}
+
+// removedFeatures merges the features turned off in values with the ones removed by flags.
+//
+// A manifest feature named after a built-in one extends it with its files and Makefile variables,
+// whether it is turned off by its -no-<id> flag or in values.
+func (m *templateManifest) removedFeatures(values map[string]string, builtin []*templateFeature) []*templateFeature {
+	ret := make([]*templateFeature, 0, len(builtin))
+	byID := map[string]*templateFeature{}
+	for _, feature := range builtin {
+		feature := *feature
+		byID[feature.ID] = &feature
+		ret = append(ret, &feature)
+	}
+	for _, f := range m.Features {
+		if values[f.Name] != "false" {
+			continue
+		}
+		feature, ok := byID[f.Name]
+		if !ok {
+			if builtin := templateFeatureByID(f.Name); builtin != nil { // turned off with -set only
+				copied := *builtin
+				feature = &copied
+			} else {
+				feature = &templateFeature{ID: f.Name, Description: f.Description}
+			}
+			byID[f.Name] = feature
+			ret = append(ret, feature)
+		}
+		feature.Files = u.UniqueStrings(append(append([]string{}, feature.Files...), f.Files...))
+		feature.MakefileVars = u.UniqueStrings(append(append([]string{}, feature.MakefileVars...), f.MakefileVars...))
+	}
+	return ret
+}
+
+// addReplacements registers the placeholders of the variables in rewriter.
+func (m *templateManifest) addReplacements(rewriter *templateRewriter, values map[string]string) {
+	for _, v := range m.Variables {
+		if v.Placeholder != "" && values[v.Name] != "" && values[v.Name] != v.Placeholder {
+			rewriter.addReplacement(v.Placeholder, values[v.Name])
+		}
+	}
+}
+
+// parseFeatureValue parses a boolean, "yes" and "no" are also accepted.
+func parseFeatureValue(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+// parseTemplateSets parses the key=value items of the -set flag.
+func parseTemplateSets(items []string) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, item := range items {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid -set %q, expected key=value", item) //nolint:goerr113
+		}
+		ret[parts[0]] = parts[1]
+	}
+	return ret, nil
+}
+
+// stringSliceFlag is a flag.Value that can be repeated.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTemplateManifest = `
+variables:
+  - name: description
+    placeholder: A golang repo template
+  - name: license
+    placeholder: Apache-2.0
+    default: Apache-2.0
+    choices: [Apache-2.0, MIT]
+  - name: go-version
+    placeholder: "1.19"
+    default: "1.21"
+    pattern: '^1\.\d+$'
+features:
+  - name: docker
+    files: [Dockerfile]
+    makefile-vars: [DOCKER_IMAGE]
+  - name: gitpod
+    default: false
+    files: [.gitpod.Dockerfile]
+`
+
+func TestTemplateManifestResolve(t *testing.T) {
+	m, err := parseTemplateManifest([]byte(testTemplateManifest))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	values, err := m.resolve(map[string]string{"description": "Foo bar", "license": "MIT", "docker": "false"}, nil)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	expected := map[string]string{"description": "Foo bar", "license": "MIT", "go-version": "1.21", "docker": "false", "gitpod": "false"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+
+	for _, set := range []map[string]string{
+		{},                                       // description is required
+		{"description": "x", "license": "GPL"},   // not a choice
+		{"description": "x", "go-version": "2"},  // does not match the pattern
+		{"description": "x", "docker": "maybe"},  // not a boolean
+		{"description": "x", "unknown": "value"}, // not declared
+	} {
+		if _, err := m.resolve(set, nil); err == nil {
+			t.Errorf("%v: expected an error", set)
+		}
+	}
+}
+
+func TestTemplateManifestPrompt(t *testing.T) {
+	m, err := parseTemplateManifest([]byte(testTemplateManifest))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	pr := &prompter{in: bufio.NewReader(strings.NewReader("\nFoo bar\nGPL\n\n\ny\n")), w: ioutil.Discard}
+	values, err := m.resolve(map[string]string{"docker": "false"}, pr)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	expected := map[string]string{"description": "Foo bar", "license": "Apache-2.0", "go-version": "1.21", "docker": "false", "gitpod": "true"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
+
+func TestTemplateManifestRemovedFeatures(t *testing.T) {
+	m, err := parseTemplateManifest([]byte(testTemplateManifest))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	builtin := []*templateFeature{{ID: "gitpod", Files: []string{".gitpod.yml"}}}
+	features := m.removedFeatures(map[string]string{"docker": "false", "gitpod": "false"}, builtin)
+	// docker is only turned off with -set, but the built-in feature is removed too
+	expected := []*templateFeature{
+		{ID: "gitpod", Files: []string{".gitpod.yml", ".gitpod.Dockerfile"}, MakefileVars: []string{}},
+		{ID: "docker", Description: "Docker image", Files: []string{"Dockerfile", ".dockerignore", ".github/workflows/docker.yml"}, MakefileVars: []string{"DOCKER_IMAGE"}},
+	}
+	if !reflect.DeepEqual(features, expected) {
+		t.Errorf("expected %+v, got %+v", expected, features)
+	}
+	if len(builtin[0].Files) != 1 || len(templateFeatureByID("docker").Files) != 3 {
+		t.Errorf("the built-in features should not be modified")
+	}
+
+	// a manifest feature without built-in counterpart
+	m.Features[0].Name = "container"
+	features = m.removedFeatures(map[string]string{"container": "false"}, nil)
+	expected = []*templateFeature{{ID: "container", Files: []string{"Dockerfile"}, MakefileVars: []string{"DOCKER_IMAGE"}}}
+	if !reflect.DeepEqual(features, expected) {
+		t.Errorf("expected %+v, got %+v", expected, features)
+	}
+}
+
+func TestParseTemplateManifestErrors(t *testing.T) {
+	for _, content := range []string{
+		"variables: [{name: a}, {name: a}]",
+		"variables: [{name: a, pattern: '('}]",
+		"variables: [{name: a, default: c, choices: [b]}]",
+		"unknown: true",
+	} {
+		if _, err := parseTemplateManifest([]byte(content)); err == nil {
+			t.Errorf("%q: expected an error", content)
+		}
+	}
+}
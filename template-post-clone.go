@@ -2,36 +2,41 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"text/tabwriter"
 
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
-	"moul.io/u"
 )
 
 func doTemplatePostClone(ctx context.Context, args []string) error {
-	if len(args) < 1 {
-		return flag.ErrHelp
+	paths, err := targetPaths(args)
+	if err != nil {
+		return err
 	}
-	paths := u.UniqueStrings(args)
 	g, ctx := errgroup.WithContext(ctx)
 	logger.Debug("doTemplatePostClone", zap.Any("opts", opts), zap.Strings("projects", paths))
 
-	var errs error
-
+	var (
+		errs  error
+		mutex sync.Mutex
+	)
 	for _, path := range paths {
 		path := path
 		g.Go(func() error {
-			err := doTemplatePostCloneOnce(ctx, path)
+			err := runWriteCommand(ctx, "template-post-clone", path, opts.TemplatePostClone.Project, func(project *project) error {
+				return doTemplatePostCloneOnce(ctx, project)
+			})
+			mutex.Lock()
+			defer mutex.Unlock()
 			if err != nil {
 				errs = multierr.Append(errs, fmt.Errorf("%q: %w", path, err))
 			}
@@ -42,13 +47,7 @@ func doTemplatePostClone(ctx context.Context, args []string) error {
 	return errs
 }
 
-//nolint:gocognit,nestif
-func doTemplatePostCloneOnce(_ context.Context, path string) error {
-	project, err := projectFromPath(path)
-	if err != nil {
-		return fmt.Errorf("invalid project: %w", err)
-	}
-
+func doTemplatePostCloneOnce(ctx context.Context, project *project) error {
 	// prepare workspace
 	{
 		err := project.prepareWorkspace(opts.TemplatePostClone.Project)
@@ -57,113 +56,243 @@ func doTemplatePostCloneOnce(_ context.Context, path string) error {
 		}
 	}
 
-	// rm go binary
-	if opts.TemplatePostClone.RemoveGoBinary {
-		logger.Debug("remove go binary", zap.String("project", project.Path))
-		// git rm main*.go
-		err := project.Git.workTree.RemoveGlob("main*.go")
+	// the project is still a clone of the template, remember the commit for template-sync
+	head, err := project.Git.repo.Head()
+	if err != nil {
+		return fmt.Errorf("get HEAD: %w", err)
+	}
+	template := opts.TemplatePostClone.Template.TemplateOwner + "/" + opts.TemplatePostClone.Template.TemplateName
+	if err := project.applyTemplate(ctx, opts.TemplatePostClone.Template, template, head.Hash().String()); err != nil {
+		return err
+	}
+
+	// push changes
+	{
+		_, err := project.pushChanges(ctx, opts.TemplatePostClone.Project, "dev/moul/template-post-clone", "chore: template post clone 🤖")
 		if err != nil {
-			return fmt.Errorf("rm main*.go: %w", err)
+			return fmt.Errorf("push changes: %w", err)
 		}
+	}
+	return nil
+}
 
-		// patch Makefile
-		{
-			path := filepath.Join(project.Git.Root, "Makefile")
-			content, err := ioutil.ReadFile(path)
-			if err != nil {
-				return fmt.Errorf("read Makefile: %w", err)
-			}
-			content = regexp.MustCompile(`(?m)^(DOCKER_IMAGE|GOBINS|NPM_PACKAGES) .=.*\n`).ReplaceAll(content, []byte(""))
-			content = regexp.MustCompile(`(?ms)^generate:.*.PHONY: generate`).ReplaceAll(content, []byte(""))
-			content = regexp.MustCompile(`(?ms)^\n\n\n\n`).ReplaceAll(content, []byte("\n\n"))
-			err = ioutil.WriteFile(path, content, 0)
-			if err != nil {
-				return fmt.Errorf("write file: %q: %w", path, err)
-			}
-			if _, err := project.Git.workTree.Add("Makefile"); err != nil {
-				return fmt.Errorf("git add %q: %w", path, err)
-			}
+// applyTemplate turns a fresh clone of a template into the project: it removes the unwanted features,
+// replaces the template's name and owner, and records the template in the manifest.
+//
+//nolint:gocognit,nestif
+func (p *project) applyTemplate(ctx context.Context, opts templateOpts, template, templateCommit string) error {
+	// template manifest
+	var (
+		manifest *templateManifest
+		values   map[string]string
+		features = opts.removedFeatures()
+	)
+	{
+		var err error
+		manifest, err = loadTemplateManifest(p.Path)
+		if err != nil {
+			return err
 		}
-
-		// remove files
-		for _, filename := range []string{"Dockerfile", ".goreleaser.yml", ".github/workflows/docker.yml"} {
-			_, err := project.Git.workTree.Remove(filename)
+		if manifest != nil {
+			set, err := parseTemplateSets(opts.Set)
 			if err != nil {
-				return fmt.Errorf("git rm %q: %w", filename, err)
+				return err
 			}
-		}
-
-		// perform various tasks
-		{
-			script := `
-			main() {
-				make generate go.depaware-update
-				git add AUTHORS README.md depaware.txt
-				make tidy
-				git add go.mod go.sum
-				git status
+			for _, feature := range features { // -no-<id> flags also turn off the manifest features
+				if _, ok := set[feature.ID]; !ok && manifest.hasFeature(feature.ID) {
+					set[feature.ID] = "false"
+				}
 			}
-			main
-		`
-			cmd := exec.Command("/bin/sh", "-xec", script)
-			cmd.Stdout = os.Stderr
-			cmd.Stderr = os.Stderr
-			cmd.Dir = project.Path
-			cmd.Env = os.Environ()
-
-			err := cmd.Run()
+			values, err = manifest.resolve(set, newPrompter())
 			if err != nil {
-				return fmt.Errorf("standard script execution failed: %w", err)
+				return fmt.Errorf("template variables: %w", err)
+			}
+			features = manifest.removedFeatures(values, features)
+			if _, err := p.Git.workTree.Remove(templateManifestFilename); err != nil {
+				if err := os.Remove(filepath.Join(p.Path, templateManifestFilename)); err != nil {
+					return fmt.Errorf("rm %q: %w", templateManifestFilename, err)
+				}
 			}
+		} else if len(opts.Set) > 0 {
+			return fmt.Errorf("-set requires a %s in the template", templateManifestFilename) //nolint:goerr113
 		}
 	}
 
+	// remove features
+	if err := p.removeFeatures(ctx, features); err != nil {
+		return err
+	}
+
 	// find and replace
 	{
-		logger.Debug("patch files to remove template strings", zap.String("project", project.Path))
-		visit := func(path string, info fs.FileInfo, err error) error {
+		logger.Debug("patch files to remove template strings", zap.String("project", p.Path))
+		rewriter := newTemplateRewriter(p, opts.TemplateName, opts.TemplateOwner)
+		var modules *moduleRewriter
+		if p.Git.Metadata.GoModPath != "" {
+			modules = &moduleRewriter{From: p.Git.Metadata.GoModPath, To: modulePathFromRule(opts.ModulePath, p)}
+			// the module path can be mentioned in docs, i.e., "go get moul.io/golang-repo-template"
+			rewriter.addReplacement(modules.From, modules.To)
+		}
+		if manifest != nil {
+			manifest.addReplacements(rewriter, values)
+		}
+		filter, err := newRewriteFilter(p, splitList(opts.Exclude), opts.MaxFileSize)
+		if err != nil {
+			return err
+		}
+		replacements := map[string]map[string]int{}
+		skipped := map[string]string{}
+		visit := func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return fmt.Errorf("walk dir: %q: %w", path, err)
 			}
-			if info.IsDir() && info.Name() == ".git" {
-				return filepath.SkipDir
+			rel, _ := filepath.Rel(p.Path, path)
+			rel = filepath.ToSlash(rel)
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				if reason := filter.skipPath(rel, true); rel != "." && reason != "" {
+					skipped[rel+"/"] = reason
+					return filepath.SkipDir
+				}
+				return nil
 			}
-			if info.IsDir() {
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if reason := filter.skipPath(rel, false); reason != "" {
+				skipped[rel] = reason
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return fmt.Errorf("stat %q: %w", rel, err)
+			}
+			var content []byte
+			reason, err := filter.skipContent(info.Size(), func() ([]byte, error) {
+				content, err = ioutil.ReadFile(path)
+				return content, err
+			})
+			if err != nil {
+				return fmt.Errorf("read file: %q: %w", path, err)
+			}
+			if reason != "" {
+				skipped[rel] = reason
 				return nil
 			}
-			// FIXME: ignore binary files
-			// FIXME: ignore huge files
 
 			// find & replace per file
-			{
-				content, err := ioutil.ReadFile(path)
+			newContent, counts, reason, err := rewriteTemplateFile(rel, content, rewriter, modules)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				skipped[rel] = reason
+				return nil
+			}
+			if len(counts) > 0 {
+				logger.Debug("patch file", zap.String("path", path))
+				replacements[rel] = counts
+				err = ioutil.WriteFile(path, newContent, 0)
 				if err != nil {
-					return fmt.Errorf("read file: %q: %w", path, err)
-				}
-				newContent := strings.ReplaceAll(string(content), opts.TemplatePostClone.TemplateName, project.Git.RepoName)
-				newContent = strings.ReplaceAll(newContent, opts.TemplatePostClone.TemplateOwner, project.Git.RepoOwner)
-				if string(content) != newContent {
-					logger.Debug("patch file", zap.String("path", path))
-					err = ioutil.WriteFile(path, []byte(newContent), 0)
-					if err != nil {
-						return fmt.Errorf("write file: %q: %w", path, err)
-					}
+					return fmt.Errorf("write file: %q: %w", path, err)
 				}
 			}
-
 			return nil
 		}
-		if err := filepath.Walk(project.Path, visit); err != nil {
+		if err := filepath.WalkDir(p.Path, visit); err != nil {
 			return fmt.Errorf("walk project's dir: %w", err)
 		}
+		fmt.Fprint(os.Stderr, replacementsSummary(p.Path, replacements))
+		fmt.Fprint(os.Stderr, skippedSummary(p.Path, skipped))
+
+		renames, err := p.templateRenames(rewriter, filter)
+		if err != nil {
+			return err
+		}
+		if err := p.applyRenames(renames); err != nil {
+			return err
+		}
+		if len(renames) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: renamed %d path(s):\n", p.Path, len(renames))
+			for _, rename := range renames {
+				fmt.Fprintf(os.Stderr, "  %s -> %s\n", rename.From, rename.To)
+			}
+		}
 	}
 
-	// push changes
+	// record template
 	{
-		err := project.pushChanges(opts.TemplatePostClone.Project, "dev/moul/template-post-clone", "chore: template post clone 🤖")
+		fields := map[string]interface{}{
+			"template":        template,
+			"template-commit": templateCommit,
+		}
+		// the features turned off, including with -no-<id>, so that template-sync skips their files
+		for _, feature := range features {
+			if values == nil {
+				values = map[string]string{}
+			}
+			values[feature.ID] = "false"
+		}
+		if len(values) > 0 {
+			fields["template-vars"] = values
+		}
+		err := p.setManifestFields(fields)
 		if err != nil {
-			return fmt.Errorf("push changes: %w", err)
+			return fmt.Errorf("update manifest: %w", err)
 		}
 	}
 	return nil
 }
+
+// replacementsSummary returns a per-file report of the replacements made by a templateRewriter.
+func replacementsSummary(path string, replacements map[string]map[string]int) string {
+	files := make([]string, 0, len(replacements))
+	for file := range replacements {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: replaced template strings in %d file(s):\n", path, len(files))
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	for _, file := range files {
+		counts := replacements[file]
+		olds := make([]string, 0, len(counts))
+		total := 0
+		for old, count := range counts {
+			olds = append(olds, old)
+			total += count
+		}
+		sort.Strings(olds)
+		details := make([]string, 0, len(olds))
+		for _, old := range olds {
+			details = append(details, fmt.Sprintf("%s (%d)", old, counts[old]))
+		}
+		fmt.Fprintf(w, "  %s\t%d\t%s\n", file, total, strings.Join(details, ", "))
+	}
+	_ = w.Flush()
+	return b.String()
+}
+
+// skippedSummary returns the files ignored by the rewriter with the reason why.
+func skippedSummary(path string, skipped map[string]string) string {
+	if len(skipped) == 0 {
+		return ""
+	}
+	files := make([]string, 0, len(skipped))
+	for file := range skipped {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: skipped %d path(s):\n", path, len(files))
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	for _, file := range files {
+		fmt.Fprintf(w, "  %s\t%s\n", file, skipped[file])
+	}
+	_ = w.Flush()
+	return b.String()
+}
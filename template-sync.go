@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/sync/errgroup"
+	"moul.io/u"
+)
+
+// templateSyncResult is the outcome of the sync of a single file.
+type templateSyncResult struct {
+	Path   string
+	Status string // added, updated, removed, excluded, or conflict
+	Reason string
+}
+
+func doTemplateSync(ctx context.Context, args []string) error {
+	paths, err := targetPaths(args)
+	if err != nil {
+		return err
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	logger.Debug("doTemplateSync", zap.Any("opts", opts), zap.Strings("projects", paths))
+
+	var (
+		errs  error
+		mutex sync.Mutex
+	)
+	for _, path := range paths {
+		path := path
+		g.Go(func() error {
+			err := runWriteCommand(ctx, "template-sync", path, opts.TemplateSync.Project, func(project *project) error {
+				return doTemplateSyncOnce(ctx, project)
+			})
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("%q: %w", path, err))
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return errs
+}
+
+//nolint:gocognit
+func doTemplateSyncOnce(ctx context.Context, project *project) error {
+	// prepare workspace
+	{
+		err := project.prepareWorkspace(opts.TemplateSync.Project)
+		if err != nil {
+			return fmt.Errorf("prepare workspace: %w", err)
+		}
+	}
+
+	// resolve template commits
+	src, base := opts.TemplateSync.Template, opts.TemplateSync.Base
+	if project.Manifest != nil {
+		if src == "" {
+			src = project.Manifest.Template
+		}
+		if base == "" {
+			base = project.Manifest.TemplateCommit
+		}
+	}
+	if base == "" {
+		return fmt.Errorf("unknown template commit, use -base or set 'template-commit' in repoman.yml") //nolint:goerr113
+	}
+	template, err := openTemplate(ctx, src)
+	if err != nil {
+		return err
+	}
+	baseCommit, err := resolveCommit(template, base)
+	if err != nil {
+		return fmt.Errorf("resolve base: %w", err)
+	}
+	targetCommit, err := resolveCommit(template, opts.TemplateSync.Ref)
+	if err != nil {
+		return fmt.Errorf("resolve ref: %w", err)
+	}
+	if baseCommit.Hash == targetCommit.Hash {
+		logger.Info("already in sync with the template", zap.String("project", project.Path), zap.String("commit", base))
+		return nil
+	}
+
+	// merge template changes
+	rewriter := newTemplateRewriter(project, opts.TemplateSync.TemplateName, opts.TemplateSync.TemplateOwner)
+	modules, err := project.templateModules(targetCommit)
+	if err != nil {
+		return err
+	}
+	if modules != nil {
+		// the module path can be mentioned in docs, like with template-post-clone
+		rewriter.addReplacement(modules.From, modules.To)
+	}
+	var disabled []*templateFeature
+	if project.Manifest != nil && len(project.Manifest.TemplateVars) > 0 {
+		vars := project.Manifest.TemplateVars
+		for _, feature := range templateFeatures { // turned off with -no-<id>
+			if vars[feature.ID] == "false" {
+				disabled = append(disabled, feature)
+			}
+		}
+		if file, err := targetCommit.File(templateManifestFilename); err == nil {
+			content, err := file.Contents()
+			if err != nil {
+				return fmt.Errorf("read template manifest: %w", err)
+			}
+			manifest, err := parseTemplateManifest([]byte(content))
+			if err != nil {
+				return fmt.Errorf("invalid template manifest: %w", err)
+			}
+			manifest.addReplacements(rewriter, vars)
+			disabled = manifest.removedFeatures(vars, disabled)
+		}
+	}
+	results, err := project.mergeTemplateChanges(ctx, rewriter, modules, disabled, baseCommit, targetCommit)
+	if err != nil {
+		return err
+	}
+
+	// report
+	conflicts := 0
+	{
+		var report bytes.Buffer
+		fmt.Fprintf(&report, "%s: template changes from %s to %s:\n", project.Path, baseCommit.Hash.String()[:7], targetCommit.Hash.String()[:7])
+		w := tabwriter.NewWriter(&report, 0, 8, 2, ' ', 0)
+		for _, result := range results {
+			if result.Status == "conflict" {
+				conflicts++
+			}
+			if result.Reason != "" {
+				fmt.Fprintf(w, "  %s\t%s: %s\n", result.Path, result.Status, result.Reason)
+			} else {
+				fmt.Fprintf(w, "  %s\t%s\n", result.Path, result.Status)
+			}
+		}
+		_ = w.Flush()
+		fmt.Fprint(os.Stderr, report.String())
+		if conflicts > 0 {
+			logger.Warn("conflicts need to be resolved manually", zap.String("project", project.Path), zap.Int("conflicts", conflicts))
+		}
+	}
+
+	// leave the conflicts out of the pull-request
+	if conflicts > 0 && opts.TemplateSync.Project.OpenPR && !opts.TemplateSync.Project.DryRun {
+		var note strings.Builder
+		fmt.Fprintf(&note, "Conflicts with the template, left out of this pull-request, to merge manually with `repoman template-sync -base %s -ref %s`:\n", baseCommit.Hash, targetCommit.Hash)
+		for _, result := range results {
+			if result.Status != "conflict" {
+				continue
+			}
+			if err := project.restoreFile(result.Path); err != nil {
+				return fmt.Errorf("restore %q: %w", result.Path, err)
+			}
+			fmt.Fprintf(&note, "- `%s`: %s\n", result.Path, result.Reason)
+		}
+		project.notes = append(project.notes, note.String())
+	}
+
+	// record the synced commit
+	{
+		fields := map[string]interface{}{"template-commit": targetCommit.Hash.String()}
+		if project.Manifest == nil || project.Manifest.Template == "" {
+			fields["template"] = src
+		}
+		if err := project.setManifestFields(fields); err != nil {
+			return fmt.Errorf("update manifest: %w", err)
+		}
+	}
+
+	// push changes
+	{
+		_, err := project.pushChanges(ctx, opts.TemplateSync.Project, "dev/moul/template-sync", "chore: sync with template 🤖")
+		if err != nil {
+			return fmt.Errorf("push changes: %w", err)
+		}
+	}
+	return nil
+}
+
+// restoreFile restores the content of a file from HEAD, in the worktree and in the index.
+func (p *project) restoreFile(name string) error {
+	head, err := p.Git.repo.Head()
+	if err != nil {
+		return fmt.Errorf("get HEAD: %w", err)
+	}
+	commit, err := p.Git.repo.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("get HEAD commit: %w", err)
+	}
+	file, err := commit.File(p.gitPath(name))
+	if errors.Is(err, object.ErrFileNotFound) { // i.e., removed locally
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get file: %w", err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+	mode, err := file.Mode.ToOSFileMode()
+	if err != nil {
+		return fmt.Errorf("file mode: %w", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(p.Path, name), []byte(content), mode); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if _, err := p.Git.workTree.Add(p.gitPath(name)); err != nil {
+		return fmt.Errorf("git add: %w", err)
+	}
+	return nil
+}
+
+// templateModules returns the rewriter of the template's module path, read in the go.mod of commit,
+// into the project's one, or nil if either is not a Go module.
+func (p *project) templateModules(commit *object.Commit) (*moduleRewriter, error) {
+	if p.Git.Metadata.GoModPath == "" {
+		return nil, nil
+	}
+	file, err := commit.File("go.mod")
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get template go.mod: %w", err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("read template go.mod: %w", err)
+	}
+	path := modfile.ModulePath([]byte(content))
+	if path == "" {
+		return nil, nil
+	}
+	return &moduleRewriter{From: path, To: p.Git.Metadata.GoModPath}, nil
+}
+
+func resolveCommit(repo *git.Repository, rev string) (*object.Commit, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", rev, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("get commit %q: %w", rev, err)
+	}
+	return commit, nil
+}
+
+// mergeTemplateChanges three-way merges the changes made to the template between base and target into the worktree.
+//
+// Conflicting files are written with conflict markers, the files removed from the template but modified locally are kept.
+// The files of the disabled features, and the template's manifest, are skipped.
+// The template files are rewritten like with template-post-clone, with the Go-aware rewriters for Go files.
+//
+//nolint:gocognit,gocyclo
+func (p *project) mergeTemplateChanges(ctx context.Context, rewriter *templateRewriter, modules *moduleRewriter, disabled []*templateFeature, base, target *object.Commit) ([]templateSyncResult, error) {
+	baseTree, err := base.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("get base tree: %w", err)
+	}
+	targetTree, err := target.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("get target tree: %w", err)
+	}
+	changes, err := object.DiffTreeWithOptions(ctx, baseTree, targetTree, nil)
+	if err != nil {
+		return nil, fmt.Errorf("diff template: %w", err)
+	}
+
+	var exclude []string
+	if p.Manifest != nil {
+		exclude = p.Manifest.Exclude
+	}
+	readFile := func(file *object.File) ([]byte, error) {
+		if file == nil {
+			return nil, nil
+		}
+		content, err := file.Contents()
+		if err != nil {
+			return nil, fmt.Errorf("read template file %q: %w", file.Name, err)
+		}
+		if u.IsBinary([]byte(content)) {
+			return []byte(content), nil
+		}
+		rewritten, _, _, err := rewriteTemplateFile(file.Name, []byte(content), rewriter, modules)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite template file: %w", err)
+		}
+		return rewritten, nil
+	}
+
+	results := make([]templateSyncResult, 0, len(changes))
+	for _, change := range changes {
+		fromFile, toFile, err := change.Files()
+		if err != nil {
+			return nil, fmt.Errorf("get changed files: %w", err)
+		}
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		if name == templateManifestFilename {
+			continue
+		}
+		name = rewriter.rewrite(name)
+		result := templateSyncResult{Path: name}
+		if matchAnyGlob(exclude, name) {
+			result.Status = "excluded"
+			results = append(results, result)
+			continue
+		}
+		if feature := featureOwning(disabled, name); feature != nil {
+			result.Status, result.Reason = "excluded", feature.ID+" is disabled"
+			results = append(results, result)
+			continue
+		}
+
+		baseContent, err := readFile(fromFile)
+		if err != nil {
+			return nil, err
+		}
+		theirs, err := readFile(toFile)
+		if err != nil {
+			return nil, err
+		}
+		fullPath := filepath.Join(p.Path, name)
+		ours, err := ioutil.ReadFile(fullPath)
+		exists := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read file: %q: %w", name, err)
+		}
+
+		switch {
+		case toFile == nil: // removed from the template
+			switch {
+			case !exists:
+				continue
+			case !bytes.Equal(ours, baseContent):
+				result.Status, result.Reason = "conflict", "removed from the template, but modified locally"
+			default:
+				if _, err := p.Git.workTree.Remove(p.gitPath(name)); err != nil {
+					return nil, fmt.Errorf("git rm %q: %w", name, err)
+				}
+				result.Status = "removed"
+			}
+		case exists && bytes.Equal(ours, theirs): // already up to date
+			continue
+		case !exists && fromFile != nil: // modified in the template
+			result.Status, result.Reason = "conflict", "modified in the template, but removed locally"
+		default:
+			merged, status := theirs, "updated"
+			if !exists {
+				status = "added"
+			} else if !bytes.Equal(ours, baseContent) {
+				if u.IsBinary(ours) || u.IsBinary(theirs) {
+					result.Status, result.Reason = "conflict", "binary file modified locally"
+					break
+				}
+				var conflicts int
+				merged, conflicts, err = mergeFile(ctx, ours, baseContent, theirs)
+				if err != nil {
+					return nil, fmt.Errorf("merge %q: %w", name, err)
+				}
+				status = "merged"
+				if conflicts > 0 {
+					status, result.Reason = "conflict", fmt.Sprintf("%d conflicting hunk(s)", conflicts)
+				}
+			}
+			if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+				return nil, fmt.Errorf("mkdir %q: %w", filepath.Dir(name), err)
+			}
+			mode, err := toFile.Mode.ToOSFileMode()
+			if err != nil {
+				return nil, fmt.Errorf("file mode: %q: %w", name, err)
+			}
+			if err := ioutil.WriteFile(fullPath, merged, mode); err != nil {
+				return nil, fmt.Errorf("write file: %q: %w", name, err)
+			}
+			if _, err := p.Git.workTree.Add(p.gitPath(name)); err != nil {
+				return nil, fmt.Errorf("git add %q: %w", name, err)
+			}
+			result.Status = status
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// mergeFile performs a three-way merge with "git merge-file", it returns the merged content and the number of conflicts.
+func mergeFile(ctx context.Context, ours, base, theirs []byte) ([]byte, int, error) {
+	dir, err := ioutil.TempDir("", "repoman-merge")
+	if err != nil {
+		return nil, 0, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := []string{"ours", "base", "template"}
+	for i, content := range [][]byte{ours, base, theirs} {
+		if err := ioutil.WriteFile(filepath.Join(dir, names[i]), content, 0o600); err != nil {
+			return nil, 0, fmt.Errorf("write file: %w", err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "merge-file", "-p", "-L", "ours", "-L", "base", "-L", "template", "ours", "base", "template")
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return stdout.Bytes(), 0, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128:
+		return stdout.Bytes(), exitErr.ExitCode(), nil
+	default:
+		return nil, 0, fmt.Errorf("git merge-file: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+}
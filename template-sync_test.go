@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"moul.io/u"
+)
+
+func TestMergeFile(t *testing.T) {
+	ctx := context.Background()
+	base := "a\nb\nc\nd\ne\n"
+
+	merged, conflicts, err := mergeFile(ctx, []byte("a\nb\nc\nd\ne\nlocal\n"), []byte(base), []byte("A\nb\nc\nd\ne\n"))
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if conflicts != 0 || string(merged) != "A\nb\nc\nd\ne\nlocal\n" {
+		t.Errorf("unexpected merge: %d conflict(s):\n%s", conflicts, merged)
+	}
+
+	merged, conflicts, err = mergeFile(ctx, []byte("mine\nb\nc\nd\ne\n"), []byte(base), []byte("theirs\nb\nc\nd\ne\n"))
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	expected := "<<<<<<< ours\nmine\n=======\ntheirs\n>>>>>>> template\nb\nc\nd\ne\n"
+	if conflicts != 1 || string(merged) != expected {
+		t.Errorf("unexpected merge: %d conflict(s):\n%s", conflicts, merged)
+	}
+}
+
+func TestTemplateSync(t *testing.T) {
+	logger = zap.NewNop()
+	fake := &fakeGitHub{opened: map[string]int{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	t.Setenv("GITHUB_API_URL", server.URL+"/")
+	t.Setenv("GITHUB_TOKEN", "")
+	for _, key := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(key+"_NAME", "t")
+		t.Setenv(key+"_EMAIL", "t@t")
+	}
+	saved := opts.TemplateSync
+	defer func() { opts.TemplateSync = saved }()
+	ctx := context.Background()
+
+	git := func(dir string, args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(dir string, files map[string]string) {
+		for name, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	read := func(path string) string {
+		content, _ := ioutil.ReadFile(path)
+		return string(content)
+	}
+	const lines = "a\nb\nc\nd\ne\n"
+
+	// template
+	template := t.TempDir()
+	git(template, "init", "-q", "-b", "main")
+	write(template, map[string]string{"updated.txt": lines, "removed.txt": lines, "conflict.txt": lines})
+	git(template, "add", "-A")
+	git(template, "commit", "-qm", "base")
+	base := git(template, "rev-parse", "HEAD")
+	write(template, map[string]string{"updated.txt": "A\n" + lines[2:], "conflict.txt": "template\n" + lines[2:], "added.txt": "new\n"})
+	git(template, "rm", "-q", "removed.txt")
+	git(template, "add", "-A")
+	git(template, "commit", "-qm", "target")
+	target := git(template, "rev-parse", "HEAD")
+
+	// project, generated from the base commit, with a local change
+	origin := t.TempDir()
+	git(origin, "init", "-q", "--bare", "-b", "main")
+	work := t.TempDir()
+	git(work, "clone", "-q", origin, ".")
+	write(work, map[string]string{
+		"updated.txt":  lines,
+		"removed.txt":  lines,
+		"conflict.txt": "local\n" + lines[2:],
+		"repoman.yml":  "template: " + template + "\ntemplate-commit: " + base + "\n",
+		"Makefile":     "",
+		"rules.mk":     "",
+	})
+	git(work, "add", "-A")
+	git(work, "commit", "-qm", "initial")
+	git(work, "push", "-q", "origin", "main")
+
+	opts.TemplateSync.Ref = "HEAD"
+	sync := func(openPR bool) {
+		opts.TemplateSync.Project = projectOpts{OpenPR: openPR}
+		p, err := projectFromPath(work)
+		if err != nil {
+			t.Fatalf("project: %v", err)
+		}
+		p.Git.Forge, p.Git.RepoOwner, p.Git.RepoName = forgeGitHub, "moul", "repoman"
+		if err := doTemplateSyncOnce(ctx, p); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+
+	// locally, the conflicts are left with markers to be resolved
+	sync(false)
+	expected := map[string]string{
+		"added.txt":    "new\n",
+		"updated.txt":  "A\n" + lines[2:],
+		"conflict.txt": "<<<<<<< ours\nlocal\n=======\ntemplate\n>>>>>>> template\n" + lines[2:],
+	}
+	for name, content := range expected {
+		if got := read(filepath.Join(work, name)); got != content {
+			t.Errorf("local: %s: expected %q, got %q", name, content, got)
+		}
+	}
+	if u.FileExists(filepath.Join(work, "removed.txt")) {
+		t.Errorf("local: expected removed.txt to be removed")
+	}
+	if manifest := read(filepath.Join(work, "repoman.yml")); !strings.Contains(manifest, target) {
+		t.Errorf("local: expected the manifest to be updated, got:\n%s", manifest)
+	}
+
+	// with a pull-request, the conflicts are left out of the commit, and listed in its body
+	git(work, "reset", "-q", "--hard")
+	git(work, "clean", "-qfd")
+	sync(true)
+	const branch = "dev/moul/template-sync"
+	expected["conflict.txt"] = "local\n" + lines[2:]
+	for name, content := range expected {
+		if got := git(origin, "show", branch+":"+name) + "\n"; got != content {
+			t.Errorf("pull-request: %s: expected %q, got %q", name, content, got)
+		}
+	}
+	if files := git(origin, "ls-tree", "--name-only", branch); strings.Contains(files, "removed.txt") {
+		t.Errorf("pull-request: expected removed.txt to be removed, got:\n%s", files)
+	}
+	if manifest := git(origin, "show", branch+":repoman.yml"); !strings.Contains(manifest, target) {
+		t.Errorf("pull-request: expected the manifest to be updated, got:\n%s", manifest)
+	}
+	for _, line := range []string{"- added: `added.txt`", "- modified: `updated.txt`", "- deleted: `removed.txt`", "- `conflict.txt`: 1 conflicting hunk(s)", "-base " + base} {
+		if !strings.Contains(fake.body, line) {
+			t.Errorf("pull-request: expected %q in the body, got:\n%s", line, fake.body)
+		}
+	}
+	if strings.Contains(fake.body, "modified: `conflict.txt`") {
+		t.Errorf("pull-request: expected conflict.txt to be left out, got:\n%s", fake.body)
+	}
+}
+
+func TestTemplateSyncGo(t *testing.T) {
+	logger = zap.NewNop()
+	for _, key := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(key+"_NAME", "t")
+		t.Setenv(key+"_EMAIL", "t@t")
+	}
+	saved := opts.TemplateSync
+	defer func() { opts.TemplateSync = saved }()
+
+	git := func(dir string, args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(dir string, files map[string]string) {
+		for name, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	const mainGo = "package main\n\nimport (\n\t\"%s/pkg\"\n\t\"tmplowner.io/u\"\n)\n\nfunc main() {\n\tu.X(pkg.Y)\n}\n"
+	const goMod = "module %s\n\ngo 1.16\n\nrequire tmplowner.io/u v1.%d.0\n"
+
+	// template, its owner is part of a dependency's path
+	template := t.TempDir()
+	git(template, "init", "-q", "-b", "main")
+	write(template, map[string]string{
+		"go.mod":  fmt.Sprintf(goMod, "tmplowner.io/golang-repo-template", 0),
+		"main.go": fmt.Sprintf(mainGo, "tmplowner.io/golang-repo-template"),
+	})
+	git(template, "add", "-A")
+	git(template, "commit", "-qm", "base")
+	base := git(template, "rev-parse", "HEAD")
+	write(template, map[string]string{
+		"go.mod":     fmt.Sprintf(goMod, "tmplowner.io/golang-repo-template", 1),
+		"main.go":    strings.Replace(fmt.Sprintf(mainGo, "tmplowner.io/golang-repo-template"), "pkg.Y", "pkg.Y, pkg.Z", 1),
+		"cmd.go":     "package main\n\nimport \"tmplowner.io/golang-repo-template/pkg\"\n\nvar _ = pkg.Z\n",
+		"Dockerfile": "FROM scratch\n",
+	})
+	git(template, "add", "-A")
+	git(template, "commit", "-qm", "target")
+
+	// project generated with -module-path github.com/{owner}/{name} -no-docker
+	work := t.TempDir()
+	git(work, "init", "-q", "-b", "main")
+	git(work, "remote", "add", "origin", "git@github.com:moul/repoman.git")
+	write(work, map[string]string{
+		"go.mod":      fmt.Sprintf(goMod, "github.com/moul/repoman", 0),
+		"main.go":     fmt.Sprintf(mainGo, "github.com/moul/repoman"),
+		"repoman.yml": "template: " + template + "\ntemplate-commit: " + base + "\ntemplate-vars: {docker: \"false\"}\n",
+		"Makefile":    "",
+		"rules.mk":    "",
+	})
+	git(work, "add", "-A")
+	git(work, "commit", "-qm", "initial")
+
+	opts.TemplateSync.Ref = "HEAD"
+	opts.TemplateSync.TemplateName = "golang-repo-template"
+	opts.TemplateSync.TemplateOwner = "tmplowner"
+	opts.TemplateSync.Project = projectOpts{}
+	p, err := projectFromPath(work)
+	if err != nil {
+		t.Fatalf("project: %v", err)
+	}
+	if err := doTemplateSyncOnce(context.Background(), p); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	expected := map[string]string{
+		"go.mod":  fmt.Sprintf(goMod, "github.com/moul/repoman", 1),
+		"main.go": strings.Replace(fmt.Sprintf(mainGo, "github.com/moul/repoman"), "pkg.Y", "pkg.Y, pkg.Z", 1),
+		"cmd.go":  "package main\n\nimport \"github.com/moul/repoman/pkg\"\n\nvar _ = pkg.Z\n",
+	}
+	for name, content := range expected {
+		if got, _ := ioutil.ReadFile(filepath.Join(work, name)); string(got) != content {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", name, content, got)
+		}
+	}
+	if u.FileExists(filepath.Join(work, "Dockerfile")) {
+		t.Errorf("expected the Dockerfile of the disabled docker feature to be skipped")
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"moul.io/u"
+)
+
+// templateRewriter replaces the template's owner and name with the project's ones.
+//
+// Each name is also replaced in its kebab, snake, camel, pascal and screaming case variants,
+// i.e., "GolangRepoTemplate" becomes "FooBar" and "GOLANG_REPO_TEMPLATE" becomes "FOO_BAR".
+type templateRewriter struct {
+	TemplateName  string
+	TemplateOwner string
+	Name          string
+	Owner         string
+
+	pairs [][2]string // old and new strings, longest first
+}
+
+func newTemplateRewriter(p *project, templateName, templateOwner string) *templateRewriter {
+	r := &templateRewriter{
+		TemplateName:  templateName,
+		TemplateOwner: templateOwner,
+		Name:          p.Git.RepoName,
+		Owner:         p.Git.RepoOwner,
+	}
+	seen := map[string]bool{}
+	for _, names := range [][2]string{{r.TemplateName, r.Name}, {r.TemplateOwner, r.Owner}} {
+		olds, news := caseVariants(names[0]), caseVariants(names[1])
+		for i := range olds {
+			if olds[i] == "" || seen[olds[i]] {
+				continue
+			}
+			seen[olds[i]] = true
+			r.pairs = append(r.pairs, [2]string{olds[i], news[i]})
+		}
+	}
+	sort.SliceStable(r.pairs, func(i, j int) bool { return len(r.pairs[i][0]) > len(r.pairs[j][0]) })
+	return r
+}
+
+// addReplacement registers an extra replacement, which takes precedence over the shorter ones.
+func (r *templateRewriter) addReplacement(old, new string) {
+	r.pairs = append([][2]string{{old, new}}, r.pairs...)
+	sort.SliceStable(r.pairs, func(i, j int) bool { return len(r.pairs[i][0]) > len(r.pairs[j][0]) })
+}
+
+// forGoCode returns a copy of r for the code of Go files, where the template's owner alone is too common to be
+// replaced, i.e., "moul" in "moul.io/u"; only the module path, the template's name and the extra replacements are kept.
+func (r *templateRewriter) forGoCode(modules *moduleRewriter) *templateRewriter {
+	ret := *r
+	ret.pairs = nil
+	name := map[string]bool{}
+	for _, variant := range caseVariants(r.TemplateName) {
+		name[variant] = true
+	}
+	owner := map[string]bool{}
+	for _, variant := range caseVariants(r.TemplateOwner) {
+		owner[variant] = true
+	}
+	for _, pair := range r.pairs {
+		if owner[pair[0]] && !name[pair[0]] {
+			continue
+		}
+		ret.pairs = append(ret.pairs, pair)
+	}
+	if modules == nil {
+		return &ret
+	}
+	if to, ok := modules.rewritePath(modules.From); ok {
+		ret.addReplacement(modules.From, to)
+	}
+	return &ret
+}
+
+func (r *templateRewriter) rewrite(content string) string {
+	ret, _ := r.rewriteCount(content)
+	return ret
+}
+
+// rewriteCount rewrites content and returns the number of replacements per replaced string.
+func (r *templateRewriter) rewriteCount(content string) (string, map[string]int) {
+	var (
+		b      strings.Builder
+		counts map[string]int
+	)
+	for i := 0; i < len(content); {
+		matched := false
+		for _, pair := range r.pairs {
+			if strings.HasPrefix(content[i:], pair[0]) {
+				if counts == nil {
+					counts = map[string]int{}
+					b.Grow(len(content))
+					b.WriteString(content[:i])
+				}
+				b.WriteString(pair[1])
+				counts[pair[0]]++
+				i += len(pair[0])
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			if counts != nil {
+				b.WriteByte(content[i])
+			}
+			i++
+		}
+	}
+	if counts == nil {
+		return content, nil
+	}
+	return b.String(), counts
+}
+
+// rewriteTemplateFile rewrites a template file, with the Go-aware rewriters for go.mod and .go files.
+//
+// It returns a non-empty reason when the file is left untouched, i.e., the checksums of go.sum,
+// or a Go file that cannot be parsed, which the text rewriter would break by changing its imports.
+func rewriteTemplateFile(name string, content []byte, rewriter *templateRewriter, modules *moduleRewriter) ([]byte, map[string]int, string, error) {
+	switch {
+	case path.Base(name) == "go.sum":
+		return content, nil, "checksums", nil
+	case path.Base(name) == "go.mod":
+		newContent, count, err := rewriteGoMod(content, modules)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("%q: %w", name, err)
+		}
+		if count == 0 {
+			return newContent, nil, "", nil
+		}
+		return newContent, map[string]int{modules.From: count}, "", nil
+	case strings.HasSuffix(name, ".go"):
+		newContent, counts, err := rewriteGoFile(content, rewriter, modules)
+		if err != nil {
+			logger.Warn("cannot parse Go file, left untouched", zap.String("path", name), zap.Error(err))
+			return content, nil, "invalid Go file", nil
+		}
+		return newContent, counts, "", nil
+	default:
+		newContent, counts := rewriter.rewriteCount(string(content))
+		return []byte(newContent), counts, "", nil
+	}
+}
+
+// caseVariants returns name as is, then its kebab, snake, camel, pascal and screaming case variants.
+func caseVariants(name string) []string {
+	words := splitWords(name)
+	lower := make([]string, len(words))
+	title := make([]string, len(words))
+	for i, word := range words {
+		lower[i] = strings.ToLower(word)
+		runes := []rune(lower[i])
+		runes[0] = unicode.ToUpper(runes[0])
+		title[i] = string(runes)
+	}
+	camel := ""
+	if len(words) > 0 {
+		camel = lower[0] + strings.Join(title[1:], "")
+	}
+	return []string{
+		name,
+		strings.Join(lower, "-"),
+		strings.Join(lower, "_"),
+		camel,
+		strings.Join(title, ""),
+		strings.ToUpper(strings.Join(lower, "_")),
+	}
+}
+
+// splitWords splits an identifier on separators and on lower-to-upper case transitions.
+func splitWords(name string) []string {
+	var (
+		words   []string
+		current []rune
+	)
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+	for _, r := range name {
+		switch {
+		case r == '-' || r == '_' || r == '.' || unicode.IsSpace(r):
+			flush()
+		case unicode.IsUpper(r) && len(current) > 0 && !unicode.IsUpper(current[len(current)-1]):
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+	}
+	flush()
+	return words
+}
+
+var githubShortRepoRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// openTemplate opens the repository of a template.
+//
+// src is either a local clone, a clone URL, or a GitHub "owner/name"; remote templates are cloned in memory.
+func openTemplate(ctx context.Context, src string) (*git.Repository, error) {
+	if src == "" {
+		return nil, fmt.Errorf("no template configured") //nolint:goerr113
+	}
+	if path, err := u.ExpandPath(src); err == nil && u.DirExists(path) {
+		repo, err := git.PlainOpen(path)
+		if err != nil {
+			return nil, fmt.Errorf("open template %q: %w", path, err)
+		}
+		return repo, nil
+	}
+	url := src
+	if githubShortRepoRegex.MatchString(src) {
+		url = fmt.Sprintf("https://github.com/%s.git", src)
+	}
+	logger.Debug("clone template")
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), nil, &git.CloneOptions{URL: url})
+	if err != nil {
+		return nil, fmt.Errorf("clone template %q: %w", url, err)
+	}
+	return repo, nil
+}
+
+// setManifestFields sets top-level fields of the project's manifest and stages it.
+//
+// repoman.yml is created if the project has no manifest; comments and other fields of an existing one are kept.
+func (p *project) setManifestFields(fields map[string]interface{}) error {
+	path := filepath.Join(p.Path, manifestFilenames[0])
+	if p.Manifest != nil && p.Manifest.Path != "" { // the manifest can come from the workspace's overrides only
+		path = p.Manifest.Path
+	}
+
+	var doc yaml.Node
+	if content, err := ioutil.ReadFile(path); err == nil {
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return fmt.Errorf("parse manifest: %q: %w", path, err)
+		}
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid manifest: %q: not a mapping", path) //nolint:goerr113
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var node yaml.Node
+		if err := node.Encode(fields[key]); err != nil {
+			return fmt.Errorf("encode %q: %w", key, err)
+		}
+		if value := yamlMapValue(root, key); value != nil {
+			*value = node
+			continue
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &node)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("write file: %q: %w", path, err)
+	}
+	rel, _ := filepath.Rel(p.Path, path)
+	if _, err := p.Git.workTree.Add(p.gitPath(rel)); err != nil {
+		return fmt.Errorf("git add %q: %w", rel, err)
+	}
+
+	m, err := loadManifest(p.Path)
+	if err != nil {
+		return err
+	}
+	p.Manifest = m
+	return p.applyWorkspaceOverrides()
+}
+
+// templateRename is a path containing template strings, relative to the project's path.
+type templateRename struct {
+	From string
+	To   string
+}
+
+// templateRenames returns the files to rename, deepest first, or an error if two paths would collide.
+//
+// The paths skipped by filter are not renamed.
+func (p *project) templateRenames(rewriter *templateRewriter, filter *rewriteFilter) ([]templateRename, error) {
+	var renames []templateRename
+	walk := func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(p.Path, path)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if d.Name() == ".git" || (rel != "." && filter.skipPath(rel, true) != "") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filter.skipPath(rel, false) != "" {
+			return nil
+		}
+		if renamed := rewriter.rewrite(rel); renamed != rel {
+			renames = append(renames, templateRename{From: rel, To: renamed})
+		}
+		return nil
+	}
+	if err := filepath.WalkDir(p.Path, walk); err != nil {
+		return nil, fmt.Errorf("walk project's dir: %w", err)
+	}
+
+	// detect collisions before renaming anything
+	sources := map[string]bool{}
+	for _, rename := range renames {
+		sources[rename.From] = true
+	}
+	targets := map[string]string{}
+	for _, rename := range renames {
+		if other, found := targets[rename.To]; found {
+			return nil, fmt.Errorf("rename collision: %q and %q would both be renamed to %q", other, rename.From, rename.To) //nolint:goerr113
+		}
+		targets[rename.To] = rename.From
+		if _, err := os.Lstat(filepath.Join(p.Path, rename.To)); err == nil && !sources[rename.To] {
+			return nil, fmt.Errorf("rename collision: %q would overwrite %q", rename.From, rename.To) //nolint:goerr113
+		}
+	}
+
+	sort.Slice(renames, func(i, j int) bool {
+		di, dj := strings.Count(renames[i].From, "/"), strings.Count(renames[j].From, "/")
+		if di != dj {
+			return di > dj
+		}
+		return renames[i].From < renames[j].From
+	})
+	return renames, nil
+}
+
+// applyRenames renames the files with git, or with the filesystem for untracked ones, then removes the emptied directories.
+func (p *project) applyRenames(renames []templateRename) error {
+	index, err := p.Git.repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("read git index: %w", err)
+	}
+	dirs := map[string]bool{}
+	for _, rename := range renames {
+		from, to := filepath.Join(p.Path, rename.From), filepath.Join(p.Path, rename.To)
+		if _, err := index.Entry(p.gitPath(rename.From)); err == nil {
+			if _, err := p.Git.workTree.Move(p.gitPath(rename.From), p.gitPath(rename.To)); err != nil {
+				return fmt.Errorf("git mv %q %q: %w", rename.From, rename.To, err)
+			}
+		} else {
+			if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+				return fmt.Errorf("mkdir %q: %w", filepath.Dir(rename.To), err)
+			}
+			if err := os.Rename(from, to); err != nil {
+				return fmt.Errorf("rename %q %q: %w", rename.From, rename.To, err)
+			}
+		}
+		for dir := filepath.Dir(rename.From); dir != "."; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	emptied := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		emptied = append(emptied, dir)
+	}
+	sort.Slice(emptied, func(i, j int) bool { return len(emptied[i]) > len(emptied[j]) })
+	for _, dir := range emptied {
+		_ = os.Remove(filepath.Join(p.Path, dir)) // fails if the directory is not empty
+	}
+	return nil
+}
+
+// generatedCodeRegex matches the header of generated files, see https://golang.org/s/generatedcode.
+var generatedCodeRegex = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+// rewriteFilter selects the files a templateRewriter should not modify.
+type rewriteFilter struct {
+	exclude []string
+	maxSize int64
+	ignore  gitignore.Matcher
+	p       *project
+}
+
+func newRewriteFilter(p *project, exclude []string, maxSize int64) (*rewriteFilter, error) {
+	f := &rewriteFilter{exclude: exclude, maxSize: maxSize, p: p}
+	if p.Manifest != nil {
+		f.exclude = append(f.exclude, p.Manifest.Exclude...)
+	}
+	if p.Git.workTree != nil {
+		patterns, err := gitignore.ReadPatterns(p.Git.workTree.Filesystem, nil)
+		if err != nil {
+			return nil, fmt.Errorf("read .gitignore: %w", err)
+		}
+		f.ignore = gitignore.NewMatcher(patterns)
+	}
+	return f, nil
+}
+
+// skipPath returns why a path, relative to the project, should be skipped, or an empty string.
+func (f *rewriteFilter) skipPath(rel string, isDir bool) string {
+	if isDir && (filepath.Base(rel) == "vendor" || filepath.Base(rel) == "node_modules") {
+		return "vendored"
+	}
+	if matchAnyGlob(f.exclude, rel) {
+		return "excluded"
+	}
+	if f.ignore != nil && f.ignore.Match(strings.Split(f.p.gitPath(rel), "/"), isDir) {
+		return "gitignored"
+	}
+	return ""
+}
+
+// skipContent returns why a file should not be rewritten based on its size and content, or an empty string.
+func (f *rewriteFilter) skipContent(size int64, content func() ([]byte, error)) (string, error) {
+	if f.maxSize > 0 && size > f.maxSize {
+		return "too large", nil
+	}
+	buf, err := content()
+	if err != nil {
+		return "", err
+	}
+	head := buf
+	if len(head) > 8000 { // like git
+		head = head[:8000]
+	}
+	if u.IsBinary(head) {
+		return "binary", nil
+	}
+	if generatedCodeRegex.Match(head) {
+		return "generated", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCaseVariants(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"golang-repo-template", []string{"golang-repo-template", "golang-repo-template", "golang_repo_template", "golangRepoTemplate", "GolangRepoTemplate", "GOLANG_REPO_TEMPLATE"}},
+		{"FooBar", []string{"FooBar", "foo-bar", "foo_bar", "fooBar", "FooBar", "FOO_BAR"}},
+		{"moul", []string{"moul", "moul", "moul", "moul", "Moul", "MOUL"}},
+	}
+	for _, tt := range tests {
+		if got := caseVariants(tt.name); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestTemplateRewriter(t *testing.T) {
+	p := &project{}
+	p.Git.RepoName = "foo-bar"
+	p.Git.RepoOwner = "bob"
+	r := newTemplateRewriter(p, "golang-repo-template", "moul")
+
+	input := "moul.io/golang-repo-template\ntype GolangRepoTemplate struct{}\nGOLANG_REPO_TEMPLATE_DEBUG=1 golang_repo_template golangRepoTemplate\n@moul Moul MOUL\n"
+	expected := "bob.io/foo-bar\ntype FooBar struct{}\nFOO_BAR_DEBUG=1 foo_bar fooBar\n@bob Bob BOB\n"
+	got, counts := r.rewriteCount(input)
+	if got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+	expectedCounts := map[string]int{
+		"golang-repo-template": 1,
+		"GolangRepoTemplate":   1,
+		"GOLANG_REPO_TEMPLATE": 1,
+		"golang_repo_template": 1,
+		"golangRepoTemplate":   1,
+		"moul":                 2,
+		"Moul":                 1,
+		"MOUL":                 1,
+	}
+	if !reflect.DeepEqual(counts, expectedCounts) {
+		t.Errorf("expected %v, got %v", expectedCounts, counts)
+	}
+
+	if got, counts := r.rewriteCount("unrelated"); got != "unrelated" || counts != nil {
+		t.Errorf("unexpected rewrite: %q %v", got, counts)
+	}
+}
+
+func TestTemplateRenames(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"cmd/golang-repo-template/main.go", "cmd/golang-repo-template/sub/golang_repo_template.go", "README.md"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := &project{Path: dir}
+	p.Git.RepoName = "foo-bar"
+	p.Git.RepoOwner = "bob"
+	r := newTemplateRewriter(p, "golang-repo-template", "moul")
+	filter, err := newRewriteFilter(p, []string{"cmd/*/sub"}, 0)
+	if err != nil {
+		t.Fatalf("filter: %v", err)
+	}
+
+	renames, err := p.templateRenames(r, filter)
+	if err != nil {
+		t.Fatalf("renames: %v", err)
+	}
+	expected := []templateRename{
+		{From: "cmd/golang-repo-template/main.go", To: "cmd/foo-bar/main.go"},
+	}
+	if !reflect.DeepEqual(renames, expected) {
+		t.Errorf("expected %v, got %v", expected, renames)
+	}
+
+	// collision with an existing file
+	if err := os.MkdirAll(filepath.Join(dir, "cmd/foo-bar"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cmd/foo-bar/main.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.templateRenames(r, filter); err == nil {
+		t.Errorf("expected a collision error")
+	}
+}
+
+func TestRewriteFilter(t *testing.T) {
+	filter, err := newRewriteFilter(&project{}, []string{"*.svg"}, 10)
+	if err != nil {
+		t.Fatalf("filter: %v", err)
+	}
+	for _, tt := range []struct {
+		path     string
+		isDir    bool
+		expected string
+	}{
+		{"vendor", true, "vendored"},
+		{"web/node_modules", true, "vendored"},
+		{"logo.svg", false, "excluded"},
+		{"main.go", false, ""},
+	} {
+		if got := filter.skipPath(tt.path, tt.isDir); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.path, tt.expected, got)
+		}
+	}
+
+	for _, tt := range []struct {
+		content  string
+		maxSize  int64
+		expected string
+	}{
+		{"package foo", 10, "too large"},
+		{"\x89PNG\x00", 10, "binary"},
+		{"// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage foo\n", 0, "generated"},
+		{"package foo", 0, ""},
+	} {
+		filter.maxSize = tt.maxSize
+		got, err := filter.skipContent(int64(len(tt.content)), func() ([]byte, error) { return []byte(tt.content), nil })
+		if err != nil {
+			t.Fatalf("skip content: %v", err)
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.content, tt.expected, got)
+		}
+	}
+}
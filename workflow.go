@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// workflowTargets contains the minimal versions expected in GitHub workflows.
+type workflowTargets struct {
+	// Actions maps an action to its version, i.e., "actions/checkout" -> "v4".
+	Actions map[string]string `yaml:"actions,omitempty" json:"Actions,omitempty"`
+	// Tools maps an action to the version of the tool it installs with its "version" input,
+	// i.e., "golangci/golangci-lint-action" -> "v1.54".
+	Tools map[string]string `yaml:"tools,omitempty" json:"Tools,omitempty"`
+}
+
+// defaultWorkflowTargets can be overridden in the "workflows" section of repoman.yml.
+var defaultWorkflowTargets = workflowTargets{
+	Actions: map[string]string{
+		"actions/checkout":              "v4",
+		"actions/setup-go":              "v4",
+		"actions/setup-node":            "v3",
+		"actions/cache":                 "v3",
+		"codecov/codecov-action":        "v3",
+		"golangci/golangci-lint-action": "v3",
+		"goreleaser/goreleaser-action":  "v4",
+	},
+	Tools: map[string]string{
+		"golangci/golangci-lint-action": "v1.54",
+	},
+}
+
+// projectWorkflowTargets returns the default targets, overridden by the project's manifest.
+func projectWorkflowTargets(p *project) workflowTargets {
+	ret := workflowTargets{Actions: map[string]string{}, Tools: map[string]string{}}
+	for k, v := range defaultWorkflowTargets.Actions {
+		ret.Actions[k] = v
+	}
+	for k, v := range defaultWorkflowTargets.Tools {
+		ret.Tools[k] = v
+	}
+	if p.Manifest != nil {
+		for k, v := range p.Manifest.Workflows.Actions {
+			ret.Actions[k] = v
+		}
+		for k, v := range p.Manifest.Workflows.Tools {
+			ret.Tools[k] = v
+		}
+	}
+	return ret
+}
+
+// workflowEdit is an outdated version found in a workflow.
+type workflowEdit struct {
+	File string
+	Line int
+	Name string // action name, i.e., "actions/checkout"
+	Tool bool   // whether it is the version of the tool installed by the action rather than the action itself
+	From string
+	To   string
+
+	column int
+}
+
+func (e workflowEdit) String() string {
+	if e.Tool {
+		return fmt.Sprintf("%s:%d: %s version %s -> %s", e.File, e.Line, e.Name, e.From, e.To)
+	}
+	return fmt.Sprintf("%s:%d: %s@%s -> %s", e.File, e.Line, e.Name, e.From, e.To)
+}
+
+var matrixRefRegex = regexp.MustCompile(`^\$\{\{\s*matrix\.([A-Za-z0-9_-]+)\s*\}\}$`)
+
+// findWorkflowEdits parses a workflow and returns the versions to bump.
+//
+//nolint:gocognit
+func findWorkflowEdits(content []byte, targets workflowTargets) ([]workflowEdit, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("parse workflow: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	var edits []workflowEdit
+	bump := func(node *yaml.Node, name, current, target string, tool bool) {
+		if !versionIsOlder(current, target) {
+			return
+		}
+		edits = append(edits, workflowEdit{Line: node.Line, column: node.Column, Name: name, Tool: tool, From: current, To: target})
+	}
+	checkUses := func(uses *yaml.Node) string {
+		if uses == nil || uses.Kind != yaml.ScalarNode {
+			return ""
+		}
+		parts := strings.SplitN(uses.Value, "@", 2)
+		if len(parts) != 2 {
+			return ""
+		}
+		if target, found := targets.Actions[parts[0]]; found {
+			bump(uses, parts[0], parts[1], target, false)
+		}
+		return parts[0]
+	}
+
+	jobs := yamlMapValue(doc.Content[0], "jobs")
+	if jobs == nil || jobs.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 1; i < len(jobs.Content); i += 2 {
+		job := jobs.Content[i]
+		checkUses(yamlMapValue(job, "uses")) // reusable workflows
+		matrix := yamlMapValue(yamlMapValue(job, "strategy"), "matrix")
+
+		steps := yamlMapValue(job, "steps")
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, step := range steps.Content {
+			action := checkUses(yamlMapValue(step, "uses"))
+			target, found := targets.Tools[action]
+			if !found {
+				continue
+			}
+			version := yamlMapValue(yamlMapValue(step, "with"), "version")
+			if version == nil || version.Kind != yaml.ScalarNode {
+				continue
+			}
+			// follow "${{ matrix.xxx }}" references
+			if match := matrixRefRegex.FindStringSubmatch(version.Value); match != nil {
+				values := yamlMapValue(matrix, match[1])
+				if values == nil || values.Kind != yaml.SequenceNode {
+					continue
+				}
+				for _, value := range values.Content {
+					if value.Kind == yaml.ScalarNode {
+						bump(value, action, value.Value, target, true)
+					}
+				}
+				continue
+			}
+			bump(version, action, version.Value, target, true)
+		}
+	}
+	return edits, nil
+}
+
+// applyWorkflowEdits replaces the outdated versions in place, so that comments and formatting are kept.
+func applyWorkflowEdits(content []byte, edits []workflowEdit) ([]byte, error) {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	// edit from the end of each line, to keep the columns of the other edits valid
+	sorted := append([]workflowEdit{}, edits...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Line != sorted[j].Line {
+			return sorted[i].Line < sorted[j].Line
+		}
+		return sorted[i].column > sorted[j].column
+	})
+	for _, edit := range sorted {
+		if edit.Line < 1 || edit.Line > len(lines) {
+			return nil, fmt.Errorf("line %d out of range", edit.Line) //nolint:goerr113
+		}
+		line := lines[edit.Line-1]
+		start := len(string([]rune(string(line))[:edit.column-1])) // yaml columns are counted in runes
+		old := edit.From
+		if !edit.Tool {
+			old = edit.Name + "@" + edit.From
+		}
+		idx := bytes.Index(line[start:], []byte(old))
+		if idx == -1 {
+			return nil, fmt.Errorf("line %d: cannot find %q", edit.Line, old) //nolint:goerr113
+		}
+		offset := start + idx + len(old) - len(edit.From)
+		newLine := append([]byte{}, line[:offset]...)
+		newLine = append(newLine, edit.To...)
+		newLine = append(newLine, line[offset+len(edit.From):]...)
+		lines[edit.Line-1] = newLine
+	}
+	return bytes.Join(lines, nil), nil
+}
+
+// updateWorkflows returns the outdated versions of the project's workflows, and bumps them if write is true.
+func updateWorkflows(p *project, write bool) ([]workflowEdit, error) {
+	var files []string
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(p.Path, ".github", "workflows", pattern))
+		if err != nil {
+			return nil, fmt.Errorf("glob: %w", err)
+		}
+		files = append(files, matches...)
+	}
+
+	targets := projectWorkflowTargets(p)
+	var all []workflowEdit
+	for _, path := range files {
+		name, _ := filepath.Rel(p.Path, path)
+		if p.isExcluded(name) {
+			continue
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read file: %q: %w", name, err)
+		}
+		edits, err := findWorkflowEdits(content, targets)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", name, err)
+		}
+		for i := range edits {
+			edits[i].File = name
+		}
+		all = append(all, edits...)
+		if !write || len(edits) == 0 {
+			continue
+		}
+		newContent, err := applyWorkflowEdits(content, edits)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", name, err)
+		}
+		if err := ioutil.WriteFile(path, newContent, 0); err != nil {
+			return nil, fmt.Errorf("write file: %q: %w", name, err)
+		}
+	}
+	return all, nil
+}
+
+// versionIsOlder returns whether current is a version older than target, unparsable versions are never older.
+func versionIsOlder(current, target string) bool {
+	currentVersion, err := semver.NewVersion(current)
+	if err != nil {
+		return false
+	}
+	targetVersion, err := semver.NewVersion(target)
+	if err != nil {
+		return false
+	}
+	return currentVersion.LessThan(targetVersion)
+}
+
+// yamlMapValue returns the value of a key in a mapping node, or nil.
+func yamlMapValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func workflowsTask(_ context.Context, p *project) (TaskStatus, error) {
+	edits, err := updateWorkflows(p, true)
+	if err != nil {
+		return TaskFailed, err
+	}
+	if len(edits) == 0 {
+		return TaskUnchanged, nil
+	}
+	return TaskChanged, nil
+}
+
+var workflowsCheck = &fixableCheck{
+	simpleCheck: &simpleCheck{
+		id:          "outdated-actions",
+		description: "GitHub workflows use up-to-date actions and tools",
+		severity:    SeverityWarning,
+		run: func(p *project) ([]string, error) {
+			edits, err := updateWorkflows(p, false)
+			if err != nil {
+				return nil, err
+			}
+			messages := make([]string, 0, len(edits))
+			for _, edit := range edits {
+				messages = append(messages, edit.String())
+			}
+			return messages, nil
+		},
+	},
+	fix: func(p *project) error {
+		_, err := updateWorkflows(p, true)
+		return err
+	},
+}
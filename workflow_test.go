@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUpdateWorkflow(t *testing.T) {
+	input := `name: Go
+on: [push]
+jobs:
+  golangci-lint:
+    strategy:
+      matrix:
+        golangci_lint: [v1.53.3, v1.55.0]
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v2 # keep this comment
+      - name: lint
+        uses: "golangci/golangci-lint-action@v2.5.2"
+        with:
+          version: ${{ matrix.golangci_lint }}
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      # pinned by sha
+      - uses: actions/checkout@8e5e7e5ab8b370d6c329ec480221332ada57f0ab
+      - uses: actions/setup-go@v5
+      - uses: golangci/golangci-lint-action@v3
+        with:
+          version: 'v1.26' # old
+      - uses: golangci/golangci-lint-action@v3
+        with:
+          version: latest
+`
+	expected := `name: Go
+on: [push]
+jobs:
+  golangci-lint:
+    strategy:
+      matrix:
+        golangci_lint: [v1.54, v1.55.0]
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4 # keep this comment
+      - name: lint
+        uses: "golangci/golangci-lint-action@v3"
+        with:
+          version: ${{ matrix.golangci_lint }}
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      # pinned by sha
+      - uses: actions/checkout@8e5e7e5ab8b370d6c329ec480221332ada57f0ab
+      - uses: actions/setup-go@v5
+      - uses: golangci/golangci-lint-action@v3
+        with:
+          version: 'v1.54' # old
+      - uses: golangci/golangci-lint-action@v3
+        with:
+          version: latest
+`
+
+	edits, err := findWorkflowEdits([]byte(input), defaultWorkflowTargets)
+	if err != nil {
+		t.Fatalf("find edits: %v", err)
+	}
+	if len(edits) != 4 {
+		t.Fatalf("expected 4 edits, got %d: %v", len(edits), edits)
+	}
+	output, err := applyWorkflowEdits([]byte(input), edits)
+	if err != nil {
+		t.Fatalf("apply edits: %v", err)
+	}
+	if string(output) != expected {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+
+	// idempotent
+	edits, err = findWorkflowEdits(output, defaultWorkflowTargets)
+	if err != nil {
+		t.Fatalf("find edits: %v", err)
+	}
+	if len(edits) != 0 {
+		t.Errorf("expected no edits, got %v", edits)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"moul.io/u"
+)
+
+// workspaceFilename is looked up in the current directory, then in the user's config directory as repoman/workspace.yml.
+const workspaceFilename = "repoman.workspace.yml"
+
+// workspace lists the repositories managed by repoman, so that commands can target them without listing paths.
+//
+//	root: ~/go/src/moul.io
+//	repos:
+//	  - url: https://github.com/moul/foo
+//	    tags: [go-lib]
+//	  - url: git@github.com:moul/bar.git
+//	    path: ~/perso/bar
+//	    tags: [go-bin, docker]
+//	    overrides:  # same fields as repoman.yml, they take precedence over the project's manifest
+//	      exclude: [README.md]
+type workspace struct {
+	// Root is the directory of the repos without path, it defaults to the directory of the workspace file.
+	Root  string           `yaml:"root,omitempty"`
+	Repos []*workspaceRepo `yaml:"repos"`
+
+	// Path is the path of the file the workspace was loaded from.
+	Path string `yaml:"-"`
+}
+
+type workspaceRepo struct {
+	URL string `yaml:"url"`
+	// Path is the local clone, relative to the workspace's root, it defaults to the repo's name.
+	Path      string    `yaml:"path,omitempty"`
+	Tags      []string  `yaml:"tags,omitempty"`
+	Overrides yaml.Node `yaml:"overrides,omitempty"`
+
+	forge *forgeRepo
+}
+
+type workspaceOpts struct {
+	Path      string
+	Tags      string
+	Recursive bool
+	MaxDepth  int
+	Ignore    string
+}
+
+// workspaceOverrides are the per-repo overrides of the selected workspace repos, by repo key.
+//
+// They are keyed by repo rather than by path, so that they also apply to the copies made by -dry-run.
+var workspaceOverrides = map[string]*yaml.Node{}
+
+// repoKey identifies a repo regardless of the protocol of its clone URL, i.e., "github.com/moul/foo".
+func repoKey(host, owner, name string) string {
+	return strings.ToLower(host + "/" + owner + "/" + name)
+}
+
+// findWorkspace returns the path of the default workspace file, or an empty string.
+func findWorkspace() string {
+	candidates := []string{workspaceFilename}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "repoman", "workspace.yml"))
+	}
+	for _, candidate := range candidates {
+		if u.FileExists(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func loadWorkspace(path string) (*workspace, error) {
+	path, err := u.ExpandPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path: %q: %w", path, err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read workspace: %q: %w", path, err)
+	}
+	ws, err := parseWorkspace(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace: %q: %w", path, err)
+	}
+	ws.Path = path
+	switch {
+	case ws.Root == "":
+		ws.Root = filepath.Dir(path)
+	case strings.HasPrefix(ws.Root, "~"):
+		if ws.Root, err = u.ExpandPath(ws.Root); err != nil {
+			return nil, fmt.Errorf("invalid root: %w", err)
+		}
+	}
+	if !filepath.IsAbs(ws.Root) {
+		ws.Root = filepath.Join(filepath.Dir(path), ws.Root)
+	}
+	return ws, nil
+}
+
+func parseWorkspace(content []byte) (*workspace, error) {
+	var ws workspace
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(&ws); err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	for _, repo := range ws.Repos {
+		forgeRepo, err := parseForgeRepo(repo.URL, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid url: %q: %w", repo.URL, err)
+		}
+		repo.forge = forgeRepo
+		if repo.Overrides.Kind != 0 {
+			// decode the overrides once, to report the unknown fields early
+			raw, err := yaml.Marshal(&repo.Overrides)
+			if err != nil {
+				return nil, fmt.Errorf("%s: overrides: %w", repo.URL, err)
+			}
+			dec := yaml.NewDecoder(bytes.NewReader(raw))
+			dec.KnownFields(true)
+			if err := dec.Decode(&manifest{}); err != nil {
+				return nil, fmt.Errorf("%s: overrides: %w", repo.URL, err)
+			}
+		}
+	}
+	return &ws, nil
+}
+
+// localPath returns the absolute path of the local clone of a repo.
+func (ws *workspace) localPath(repo *workspaceRepo) string {
+	path := repo.Path
+	if path == "" {
+		path = repo.forge.Name
+	}
+	if strings.HasPrefix(path, "~") {
+		if expanded, err := u.ExpandPath(path); err == nil {
+			path = expanded
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(ws.Root, path)
+	}
+	return filepath.Clean(path)
+}
+
+// selectRepos returns the repos having at least one of the tags, or all of them if tags is empty.
+func (ws *workspace) selectRepos(tags []string) []*workspaceRepo {
+	var ret []*workspaceRepo
+	for _, repo := range ws.Repos {
+		if len(tags) == 0 {
+			ret = append(ret, repo)
+			continue
+		}
+		for _, tag := range tags {
+			if containsString(repo.Tags, tag) {
+				ret = append(ret, repo)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// targetPaths returns the projects targeted by a command: the positional paths, or the repos found under them
+// with -recursive, and the workspace repos selected by -workspace and -tag.
+func targetPaths(args []string) ([]string, error) {
+	paths := append([]string{}, args...)
+	if opts.Workspace.Recursive && len(args) > 0 {
+		var err error
+		if paths, err = discoverRepos(args, opts.Workspace.MaxDepth, splitList(opts.Workspace.Ignore)); err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no git repositories found under %s", strings.Join(args, ", ")) //nolint:goerr113
+		}
+	}
+	tags := splitList(opts.Workspace.Tags)
+	if opts.Workspace.Path != "" || len(tags) > 0 {
+		path := opts.Workspace.Path
+		if path == "" {
+			if path = findWorkspace(); path == "" {
+				return nil, fmt.Errorf("no workspace found, use -workspace or create %s", workspaceFilename) //nolint:goerr113
+			}
+		}
+		ws, err := loadWorkspace(path)
+		if err != nil {
+			return nil, err
+		}
+		repos := ws.selectRepos(tags)
+		if len(repos) == 0 {
+			return nil, fmt.Errorf("no repos matching tags %s in %s", strings.Join(tags, ","), ws.Path) //nolint:goerr113
+		}
+		for _, repo := range repos {
+			localPath := ws.localPath(repo)
+			if !u.DirExists(localPath) {
+				logger.Warn("workspace repo is not cloned, skipping", zap.String("url", repo.URL), zap.String("path", localPath))
+				continue
+			}
+			if repo.Overrides.Kind != 0 {
+				overrides := repo.Overrides
+				workspaceOverrides[repoKey(repo.forge.Host, repo.forge.Owner, repo.forge.Name)] = &overrides
+			}
+			paths = append(paths, localPath)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, flag.ErrHelp
+	}
+	return u.UniqueStrings(paths), nil
+}
+
+// applyWorkspaceOverrides merges the workspace's overrides of a project into its manifest.
+func (p *project) applyWorkspaceOverrides() error {
+	overrides := workspaceOverrides[repoKey(p.Git.Host, p.Git.RepoOwner, p.Git.RepoName)]
+	if overrides == nil {
+		return nil
+	}
+	if p.Manifest == nil {
+		p.Manifest = &manifest{}
+	}
+	if err := overrides.Decode(p.Manifest); err != nil {
+		return fmt.Errorf("workspace overrides: %w", err)
+	}
+	if p.Manifest.Forge != "" {
+		p.Git.Forge = p.Manifest.Forge
+	}
+	return nil
+}
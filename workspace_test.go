@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestTargetPaths(t *testing.T) {
+	logger = zap.NewNop()
+	root := t.TempDir()
+	for _, dir := range []string{"foo", "clones/bar"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(root, workspaceFilename)
+	content := `
+repos:
+  - url: https://github.com/moul/foo
+    tags: [go-lib]
+    overrides:
+      exclude: [README.md]
+  - url: git@github.com:moul/bar.git
+    path: clones/bar
+    tags: [go-bin, docker]
+  - url: https://github.com/moul/not-cloned
+    tags: [go-lib]
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { opts.Workspace = workspaceOpts{} }()
+
+	tests := []struct {
+		args     []string
+		opts     workspaceOpts
+		expected []string
+	}{
+		{[]string{"a", "b", "a"}, workspaceOpts{}, []string{"a", "b"}},
+		{nil, workspaceOpts{Path: path}, []string{filepath.Join(root, "foo"), filepath.Join(root, "clones/bar")}},
+		{nil, workspaceOpts{Path: path, Tags: "go-lib"}, []string{filepath.Join(root, "foo")}},
+		{[]string{"a"}, workspaceOpts{Path: path, Tags: "docker,unknown"}, []string{"a", filepath.Join(root, "clones/bar")}},
+	}
+	for _, tt := range tests {
+		opts.Workspace = tt.opts
+		got, err := targetPaths(tt.args)
+		if err != nil {
+			t.Errorf("%v %v: %v", tt.args, tt.opts, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%v %v: expected %v, got %v", tt.args, tt.opts, tt.expected, got)
+		}
+	}
+
+	// overrides are merged into the project's manifest
+	p := &project{}
+	p.Git.Host, p.Git.RepoOwner, p.Git.RepoName = "github.com", "moul", "foo"
+	if err := p.applyWorkspaceOverrides(); err != nil {
+		t.Fatalf("overrides: %v", err)
+	}
+	if p.Manifest == nil || !reflect.DeepEqual(p.Manifest.Exclude, []string{"README.md"}) {
+		t.Errorf("expected the overrides to be applied, got %+v", p.Manifest)
+	}
+
+	opts.Workspace = workspaceOpts{Path: path, Tags: "unknown"}
+	if _, err := targetPaths(nil); err == nil {
+		t.Errorf("expected an error when no repo matches")
+	}
+}
+
+func TestParseWorkspaceErrors(t *testing.T) {
+	for _, content := range []string{
+		"repos: [{url: 'https://github.com/moul/foo', unknown: true}]",
+		"repos: [{url: 'https://github.com/moul/foo', overrides: {unknown: true}}]",
+		"repos: [{url: 'not a url'}]",
+	} {
+		if _, err := parseWorkspace([]byte(content)); err == nil {
+			t.Errorf("%q: expected an error", content)
+		}
+	}
+}